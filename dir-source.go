@@ -0,0 +1,49 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UpdateFromDir applies a key-per-file directory, such as a mounted
+// Kubernetes ConfigMap or secret, as deep-path overrides. Every file name is
+// treated like an env var name and the file contents, without a single
+// trailing newline, like its value: nest__eggs__0__weight containing "5"
+// sets that path to "5". The prefix, delimiter, coercion, ordering and
+// strict mode rules of UpdateFromEnv apply, and the same kind of report is
+// returned. Dotfiles, such as the ..data links Kubernetes maintains, and
+// subdirectories are skipped. Files that cannot be read are reported like
+// rejected values; an error reading the directory itself is returned
+// without touching the settings.
+func (ve *ViperEx) UpdateFromDir(dir string) (*UpdateReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var variables []envVariable
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		// follows symlinks, which is how mounted files are usually linked;
+		// files that cannot be stat'ed fail later when they are read
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			continue
+		}
+		variable, ok := ve.newEnvVariable(name, path, "")
+		if !ok {
+			continue
+		}
+		variable.file = true
+		variables = append(variables, variable)
+	}
+	return ve.applyEnvVariables(variables)
+}
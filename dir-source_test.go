@@ -0,0 +1,99 @@
+package viperEx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDirFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+}
+
+func TestUpdateFromDir(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeDirFiles(t, dir, map[string]string{
+		"nest__eggs__0__weight": "5\n",
+		"nest__name":            "brick",
+		"nest__missing":         "x",
+		"name":                  "no prefix, ignored",
+		".hidden__name":         "hidden",
+	})
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nest__eggs"), 0o700))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "nest__name"), filepath.Join(dir, "nest__eggs__0__url")))
+
+	settings := map[string]interface{}{
+		"name": "bob",
+		"nest": map[string]interface{}{
+			"name": "straw",
+			"eggs": []interface{}{
+				map[string]interface{}{"weight": 1, "url": ""},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvTypeCoercion())
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 3)
+	_, found := findUnmatched(report, "nest__missing")
+	assert.True(t, found)
+
+	val, _ := ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 5, val)
+	val, _ = ve.Find("nest__name")
+	assert.Equal(t, "brick", val)
+	val, _ = ve.Find("nest__eggs__0__url")
+	assert.Equal(t, "brick", val)
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+}
+
+func TestUpdateFromDir_Prefix(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeDirFiles(t, dir, map[string]string{
+		"APP_name":          "alice",
+		"APP_nest__name":    "brick",
+		"OTHER_nest__name":  "ignored",
+		"APP_nest__missing": "x",
+	})
+	require.NoError(t, os.Symlink(filepath.Join(dir, "gone"), filepath.Join(dir, "APP_nest__broken")))
+
+	settings := map[string]interface{}{
+		"name": "bob",
+		"nest": map[string]interface{}{"name": "straw", "broken": ""},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("APP"), WithStrictEnv())
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromDir(dir)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	var unmatchedErr *UnmatchedEnvError
+	require.ErrorAs(t, err, &unmatchedErr)
+	assert.Contains(t, err.Error(), "APP_nest__missing")
+	assert.Len(t, report.Applied, 2)
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "nest__broken", report.Skipped[0].Key)
+
+	// strict mode leaves the settings untouched
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+}
+
+func TestUpdateFromDir_MissingDir(t *testing.T) {
+	t.Parallel()
+	ve, err := New(map[string]interface{}{}, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromDir(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Nil(t, report)
+}
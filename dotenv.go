@@ -0,0 +1,117 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dotEnvUnescaper decodes the escapes allowed in double-quoted dotenv
+// values. Other backslashes are kept as they are.
+var dotEnvUnescaper = strings.NewReplacer(
+	`\n`, "\n",
+	`\r`, "\r",
+	`\t`, "\t",
+	`\"`, `"`,
+	`\$`, `$`,
+	`\\`, `\`,
+)
+
+// ParseDotEnv parses a dotenv file into variable names and values.
+// Each line holds NAME=value, optionally preceded by "export". Blank lines
+// and lines starting with "#" are ignored. Unquoted values are trimmed and
+// end at a " #" comment. Single-quoted values are taken literally;
+// double-quoted values support the escapes \n, \r, \t, \", \$ and \\. Both
+// kinds of quoted values may span several lines. Later definitions of a
+// name replace earlier ones. Values are not expanded.
+func ParseDotEnv(r io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	result := make(map[string]string)
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimLeft(lines[i], " \t")
+		if len(strings.TrimSpace(line)) == 0 || line[0] == '#' {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export"); ok && len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimLeft(rest, " \t")
+		}
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("dotenv line %d: missing \"=\"", lineNumber)
+		}
+		name = strings.TrimRight(name, " \t")
+		if len(name) == 0 || strings.ContainsAny(name, " \t'\"") {
+			return nil, fmt.Errorf("dotenv line %d: invalid name %q", lineNumber, name)
+		}
+		value = strings.TrimLeft(value, " \t")
+		if len(value) == 0 || (value[0] != '"' && value[0] != '\'') {
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = value[:comment]
+			}
+			if comment := strings.Index(value, "\t#"); comment >= 0 {
+				value = value[:comment]
+			}
+			result[name] = strings.TrimSpace(value)
+			continue
+		}
+		quote := value[0]
+		body := value[1:]
+		end := closingQuote(body, quote)
+		for end < 0 {
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("dotenv line %d: unterminated quoted value", lineNumber)
+			}
+			body += "\n" + lines[i]
+			end = closingQuote(body, quote)
+		}
+		if rest := strings.TrimSpace(body[end+1:]); len(rest) > 0 && rest[0] != '#' {
+			return nil, fmt.Errorf("dotenv line %d: unexpected %q after quoted value", lineNumber, rest)
+		}
+		body = body[:end]
+		if quote == '"' {
+			body = dotEnvUnescaper.Replace(body)
+		}
+		result[name] = body
+	}
+	return result, nil
+}
+
+// closingQuote returns the index of the quote closing value, or -1. In
+// double-quoted values a backslash escapes the next character.
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// readDotEnvFile parses the dotenv file at path.
+func readDotEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result, err := ParseDotEnv(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package viperEx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	t.Parallel()
+	input := strings.Join([]string{
+		"# a comment",
+		"",
+		"PLAIN=value",
+		"SPACED = spaced value   ",
+		"export EXPORTED=yes",
+		"COMMENTED=value # comment",
+		"HASH=a#b",
+		"EMPTY=",
+		`SINGLE='lit\n $HOME # not a comment'`,
+		`DOUBLE="tab\there \"quoted\" \\ \$x" # comment`,
+		`MULTI="line one`,
+		`  line two"`,
+		`MULTI_SINGLE='a`,
+		`b'`,
+		"CRLF=value\r",
+		"nest__name=brick",
+		"PLAIN=override",
+	}, "\n")
+
+	env, err := ParseDotEnv(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"PLAIN":        "override",
+		"SPACED":       "spaced value",
+		"EXPORTED":     "yes",
+		"COMMENTED":    "value",
+		"HASH":         "a#b",
+		"EMPTY":        "",
+		"SINGLE":       `lit\n $HOME # not a comment`,
+		"DOUBLE":       "tab\there \"quoted\" \\ $x",
+		"MULTI":        "line one\n  line two",
+		"MULTI_SINGLE": "a\nb",
+		"CRLF":         "value",
+		"nest__name":   "brick",
+	}, env)
+}
+
+func TestParseDotEnv_Errors(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"missing equals":   "A=1\nNOVALUE",
+		"invalid name":     "BAD NAME=1",
+		"empty name":       "=1",
+		"unterminated":     "A=\"open\nstill open",
+		"text after quote": `A="quoted" trailing`,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ParseDotEnv(strings.NewReader(input))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := ParseDotEnv(strings.NewReader("A=1\nNOVALUE"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestUpdateFromEnv_DotEnvFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	require.NoError(t, os.WriteFile(base, []byte("APP_db__host=base\nAPP_db__port=1\nAPP_db__user=base\n"), 0o600))
+	require.NoError(t, os.WriteFile(local, []byte("export APP_db__port=2\nAPP_db__user=local\n"), 0o600))
+
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost", "port": "0", "user": "sa"},
+	}
+	newViperEx := func(options ...func(*ViperEx) error) *ViperEx {
+		options = append([]func(*ViperEx) error{
+			WithDelimiter(keyDelim), WithEnvPrefix("APP"),
+			WithDotEnvFile(base), WithDotEnvFile(local),
+			WithEnvSource(EnvMap{"APP_db__user": "env"}),
+		}, options...)
+		ve, err := New(settings, options...)
+		require.NoError(t, err)
+		return ve
+	}
+
+	ve := newViperEx()
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 3)
+	assert.Empty(t, report.Collisions)
+	val, _ := ve.Find("db__host")
+	assert.Equal(t, "base", val)
+	val, _ = ve.Find("db__port")
+	assert.Equal(t, "2", val)
+	val, _ = ve.Find("db__user")
+	assert.Equal(t, "env", val)
+
+	ve = newViperEx(WithDotEnvOverride())
+	_, err = ve.UpdateFromEnv()
+	require.NoError(t, err)
+	val, _ = ve.Find("db__user")
+	assert.Equal(t, "local", val)
+}
+
+func TestUpdateFromEnv_DotEnvFileErrors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	broken := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(broken, []byte("nest__name=\"unterminated\n"), 0o600))
+
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{"name": "straw"},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithDotEnvFile(broken),
+		WithEnvSource(EnvMap{"nest__name": "brick"}))
+	require.NoError(t, err)
+	report, err := ve.UpdateFromEnv()
+	assert.ErrorContains(t, err, broken)
+	assert.Nil(t, report)
+	val, _ := ve.Find("nest__name")
+	assert.Equal(t, "straw", val)
+
+	ve, err = New(settings, WithDelimiter(keyDelim), WithDotEnvFile(filepath.Join(dir, "missing")))
+	require.NoError(t, err)
+	_, err = ve.UpdateFromEnv()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
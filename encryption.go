@@ -0,0 +1,172 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// EncryptedValuePrefix starts every value produced by EncryptValue.
+	EncryptedValuePrefix = "enc:AES256GCM:"
+	// DefaultEncryptionKeyEnv is the environment variable DecryptValues
+	// reads the base64-encoded key from when no key or other variable is
+	// configured.
+	DefaultEncryptionKeyEnv = "VIPEREX_ENCRYPTION_KEY"
+	// RedactedValue replaces sensitive values in RedactedSettings.
+	RedactedValue = "[REDACTED]"
+)
+
+// ErrNoEncryptionKey reports an encrypted value without a key to decrypt it.
+var ErrNoEncryptionKey = errors.New("no encryption key")
+
+// EncryptValue encrypts plaintext with AES-256-GCM under the 32-byte key and
+// returns it in the enc:AES256GCM:<base64> form DecryptValues understands,
+// ready to be committed to a config file.
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptValue decrypts a value produced by EncryptValue.
+func decryptValue(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedValuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// newAEAD returns AES-256-GCM for key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionKey returns the EncryptionKey, or the key read from the
+// EncryptionKeyEnv (DefaultEncryptionKeyEnv if unset) variable of the
+// EnvSource.
+func (ve *ViperEx) encryptionKey() ([]byte, error) {
+	if len(ve.EncryptionKey) > 0 {
+		return ve.EncryptionKey, nil
+	}
+	name := ve.EncryptionKeyEnv
+	if len(name) == 0 {
+		name = DefaultEncryptionKeyEnv
+	}
+	for _, element := range ve.environ() {
+		if key, value, found := strings.Cut(element, "="); found && key == name {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("encryption key in %s: %w", name, err)
+			}
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: set %s", ErrNoEncryptionKey, name)
+}
+
+// DecryptValues decrypts every string value produced by EncryptValue in
+// place and marks it as sensitive, see RedactedSettings. The key is the
+// EncryptionKey, or else the base64-encoded key in the EncryptionKeyEnv
+// variable. Decryption is atomic: if any value cannot be decrypted, the
+// settings are left untouched and the returned error names every failing
+// path. On success AllSettings is replaced by the decrypted copy.
+func (ve *ViperEx) DecryptValues() error {
+	var key []byte
+	var decrypted sensitiveMarks
+	err := ve.atomically(func() error {
+		return errors.Join(ve.replaceStrings(func(path []pathSegment, value string) (interface{}, error) {
+			if !strings.HasPrefix(value, EncryptedValuePrefix) {
+				return value, nil
+			}
+			if key == nil {
+				var err error
+				if key, err = ve.encryptionKey(); err != nil {
+					return nil, fmt.Errorf("decrypt %q: %w", ve.joinPath(path), err)
+				}
+			}
+			plaintext, err := decryptValue(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("decrypt %q: %w", ve.joinPath(path), err)
+			}
+			decrypted = append(decrypted, sensitiveMark{path: path, value: plaintext})
+			return plaintext, nil
+		})...)
+	})
+	if err != nil {
+		return err
+	}
+	for _, mark := range decrypted {
+		ve.markSensitive(mark.path, mark.value)
+	}
+	return nil
+}
+
+// SensitivePaths returns the sorted deep-path keys of the sensitive values
+// currently in the settings, see RedactedSettings.
+func (ve *ViperEx) SensitivePaths() []string {
+	paths := []string{}
+	seen := make(map[string]bool)
+	for _, mark := range ve.sensitive.holding(ve.AllSettings) {
+		key := ve.joinPath(mark.path)
+		if !seen[key] {
+			seen[key] = true
+			paths = append(paths, key)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// RedactedSettings returns a copy of the settings, safe to log or dump, in
+// which every sensitive value is replaced by RedactedValue. The values
+// decrypted by DecryptValues or resolved by ResolveSecrets are sensitive, as
+// are the copies ApplyJSONPatch and Interpolate make of them and the strings
+// Interpolate embeds them in. Each is tracked by the path holding it, which
+// follows the value when RemoveDeepPath, RemovePointer or ApplyJSONPatch
+// shift an array or move it. A path that is overwritten with another value
+// is no longer sensitive.
+func (ve *ViperEx) RedactedSettings() map[string]interface{} {
+	redacted := normalizeSettings(ve.AllSettings)
+	for _, mark := range ve.sensitive.holding(ve.AllSettings) {
+		ve.setIn(redacted, mark.path, 0, RedactedValue)
+	}
+	return redacted
+}
@@ -0,0 +1,209 @@
+package viperEx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, 32)
+
+func TestEncryptValue(t *testing.T) {
+	t.Parallel()
+	encrypted, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, EncryptedValuePrefix))
+	assert.NotContains(t, encrypted, "s3cret")
+
+	again, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "every value gets its own nonce")
+
+	decrypted, err := decryptValue(testEncryptionKey, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", decrypted)
+
+	_, err = EncryptValue([]byte("short"), "s3cret")
+	assert.Error(t, err)
+}
+
+func TestDecryptValues(t *testing.T) {
+	t.Parallel()
+	password, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	token, err := EncryptValue(testEncryptionKey, "t0ken")
+	require.NoError(t, err)
+
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": password,
+			"host":     "db.internal",
+		},
+		"tokens": []interface{}{token},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEncryptionKey(testEncryptionKey))
+	require.NoError(t, err)
+
+	require.NoError(t, ve.DecryptValues())
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, "s3cret", val)
+	val, _ = ve.Find("tokens__0")
+	assert.Equal(t, "t0ken", val)
+	assert.Equal(t, []string{"db__password", "tokens__0"}, ve.SensitivePaths())
+
+	redacted := ve.RedactedSettings()
+	assert.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": RedactedValue,
+			"host":     "db.internal",
+		},
+		"tokens": []interface{}{RedactedValue},
+	}, redacted)
+	// the settings themselves are untouched
+	val, _ = ve.Find("db__password")
+	assert.Equal(t, "s3cret", val)
+}
+
+func TestDecryptValues_KeyFromEnv(t *testing.T) {
+	t.Parallel()
+	password, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(testEncryptionKey)
+	settings := map[string]interface{}{"password": password}
+
+	ve, err := New(settings, WithEnvSource(EnvMap{DefaultEncryptionKeyEnv: encodedKey}))
+	require.NoError(t, err)
+	require.NoError(t, ve.DecryptValues())
+	assert.Equal(t, "s3cret", ve.AllSettings["password"])
+
+	ve, err = New(settings, WithEncryptionKeyEnv("APP_KEY"), WithEnvSource(EnvMap{"APP_KEY": encodedKey}))
+	require.NoError(t, err)
+	require.NoError(t, ve.DecryptValues())
+	assert.Equal(t, "s3cret", ve.AllSettings["password"])
+}
+
+func TestDecryptValues_Errors(t *testing.T) {
+	t.Parallel()
+	password, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": password,
+			"token":    EncryptedValuePrefix + "not base64!",
+			"tampered": password[:len(password)-4] + "AAAA",
+		},
+	}
+
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEncryptionKey(testEncryptionKey))
+	require.NoError(t, err)
+	err = ve.DecryptValues()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `decrypt "db__token"`)
+	assert.Contains(t, err.Error(), `decrypt "db__tampered"`)
+	assert.NotContains(t, err.Error(), `"db__password"`)
+	assert.Empty(t, ve.SensitivePaths())
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, password, val)
+
+	ve, err = New(settings, WithDelimiter(keyDelim), WithEnvSource(EnvMap{}))
+	require.NoError(t, err)
+	assert.ErrorIs(t, ve.DecryptValues(), ErrNoEncryptionKey)
+
+	_, err = New(settings, WithEncryptionKey([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestRedactedSettings_FollowsValues(t *testing.T) {
+	t.Parallel()
+	password, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	token, err := EncryptValue(testEncryptionKey, "t0ken")
+	require.NoError(t, err)
+	flag, err := EncryptValue(testEncryptionKey, "true")
+	require.NoError(t, err)
+	newVE := func() *ViperEx {
+		settings := map[string]interface{}{
+			"db": map[string]interface{}{
+				"password": password,
+				"flag":     flag,
+			},
+			"enabled": "true",
+			"tokens":  []interface{}{"public", token, "other"},
+		}
+		ve, err := New(settings, WithDelimiter(keyDelim), WithEncryptionKey(testEncryptionKey))
+		require.NoError(t, err)
+		require.NoError(t, ve.DecryptValues())
+		return ve
+	}
+
+	// a plain value equal to a secret is not sensitive
+	ve := newVE()
+	assert.Equal(t, []string{"db__flag", "db__password", "tokens__1"}, ve.SensitivePaths())
+	assert.Equal(t, "true", ve.RedactedSettings()["enabled"])
+
+	// removing an array element moves the marks of the following elements
+	ve = newVE()
+	require.True(t, ve.RemoveDeepPath("tokens__0"))
+	assert.Equal(t, []string{"db__flag", "db__password", "tokens__0"}, ve.SensitivePaths())
+	assert.Equal(t, []interface{}{RedactedValue, "other"}, ve.RedactedSettings()["tokens"])
+	require.True(t, ve.RemovePointer("/tokens/0"))
+	assert.Equal(t, []string{"db__flag", "db__password"}, ve.SensitivePaths())
+
+	// overwriting a sensitive value clears the mark
+	ve = newVE()
+	require.True(t, ve.UpdateDeepPath("db__password", "plain"))
+	assert.Equal(t, []string{"db__flag", "tokens__1"}, ve.SensitivePaths())
+
+	// JSON Patch moves and copies the marks along with the values
+	ve = newVE()
+	require.NoError(t, ve.ApplyJSONPatch([]byte(`[
+		{"op": "add", "path": "/tokens/0", "value": "first"},
+		{"op": "copy", "from": "/db", "path": "/backup"},
+		{"op": "move", "from": "/tokens/2", "path": "/token"},
+		{"op": "replace", "path": "/db/flag", "value": "true"}
+	]`)))
+	assert.Equal(t, []string{"backup__flag", "backup__password", "db__password", "token"}, ve.SensitivePaths())
+	redacted := ve.RedactedSettings()
+	assert.Equal(t, []interface{}{"first", "public", "other"}, redacted["tokens"])
+	assert.Equal(t, RedactedValue, redacted["token"])
+	assert.Equal(t, map[string]interface{}{"password": RedactedValue, "flag": "true"}, redacted["db"])
+
+	// a failing patch leaves the marks untouched
+	require.Error(t, ve.ApplyJSONPatch([]byte(`[
+		{"op": "remove", "path": "/token"},
+		{"op": "remove", "path": "/missing"}
+	]`)))
+	assert.Equal(t, []string{"backup__flag", "backup__password", "db__password", "token"}, ve.SensitivePaths())
+}
+
+func TestRedactedSettings_Interpolate(t *testing.T) {
+	t.Parallel()
+	password, err := EncryptValue(testEncryptionKey, "s3cret")
+	require.NoError(t, err)
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": password,
+			"user":     "admin",
+		},
+		"copy":  "${db__password}",
+		"dsn":   "pg://${db__user}:${db__password}@host",
+		"whole": "${db}",
+		"plain": "${db__user}",
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEncryptionKey(testEncryptionKey))
+	require.NoError(t, err)
+	require.NoError(t, ve.DecryptValues())
+	require.NoError(t, ve.Interpolate())
+
+	assert.Equal(t, "pg://admin:s3cret@host", ve.AllSettings["dsn"])
+	assert.Equal(t, []string{"copy", "db__password", "dsn", "whole__password"}, ve.SensitivePaths())
+	redacted := ve.RedactedSettings()
+	assert.Equal(t, RedactedValue, redacted["copy"])
+	assert.Equal(t, RedactedValue, redacted["dsn"])
+	assert.Equal(t, "admin", redacted["plain"])
+	assert.Equal(t, map[string]interface{}{"password": RedactedValue, "user": "admin"}, redacted["whole"])
+}
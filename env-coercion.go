@@ -0,0 +1,175 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// updateFromString applies a raw string value, e.g. from an env var, to the
+// deep-path key and records the outcome in report. With EnvJSONValues a
+// JSON object or array value is decoded first; with CoerceEnvTypes the
+// value is converted to the type of each existing target. Nothing is
+// updated if the value cannot be converted for every target.
+func (ve *ViperEx) updateFromString(key string, value string, report *UpdateReport) {
+	path, ok := ve.splitKey(key)
+	if !ok {
+		report.Unmatched = append(report.Unmatched, UnmatchedKey{Key: key, Reason: ErrInvalidKey})
+		return
+	}
+	convert := func(interface{}) (interface{}, error) {
+		return value, nil
+	}
+	switch {
+	case ve.EnvJSONValues && looksLikeJSON(value):
+		decoded, err := decodeJSONValue(value)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedKey{Key: key, Value: value, Err: err})
+			return
+		}
+		convert = func(interface{}) (interface{}, error) {
+			// every target gets its own copy
+			return normalizeValue(decoded), nil
+		}
+	case ve.CoerceEnvTypes:
+		convert = func(existing interface{}) (interface{}, error) {
+			return coerceString(value, existing)
+		}
+	}
+	var applied []AppliedKey
+	var targets [][]pathSegment
+	for _, concrete := range expandPath(ve.AllSettings, path, 0) {
+		existing, _ := lookupPath(ve.AllSettings, concrete)
+		newValue, err := convert(existing)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedKey{Key: key, Value: value, Err: err})
+			return
+		}
+		targets = append(targets, concrete)
+		applied = append(applied, AppliedKey{
+			Key:      key,
+			Path:     ve.joinPath(concrete),
+			OldValue: existing,
+			NewValue: newValue,
+		})
+	}
+	updated := 0
+	for i, target := range targets {
+		if _, ok := ve.setIn(ve.AllSettings, target, 0, applied[i].NewValue); ok {
+			report.Applied = append(report.Applied, applied[i])
+			updated++
+		}
+	}
+	if updated == 0 {
+		report.Unmatched = append(report.Unmatched, UnmatchedKey{Key: key, Reason: ve.diagnose(path)})
+	}
+}
+
+// looksLikeJSON reports whether value is meant to be a JSON object or array.
+func looksLikeJSON(value string) bool {
+	trimmed := strings.TrimSpace(value)
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+}
+
+// decodeJSONValue decodes a JSON document into normalized maps and arrays,
+// exactly like data read from a config file.
+func decodeJSONValue(value string) (interface{}, error) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: %w", err)
+	}
+	return normalizeValue(decoded), nil
+}
+
+// coerceString parses value into the type of existing. Strings, nil and
+// types without a string form are returned as the raw value. Arrays are
+// split on commas and each item is converted to the type of the first
+// existing element.
+func coerceString(value string, existing interface{}) (interface{}, error) {
+	var converted interface{}
+	var err error
+	switch current := existing.(type) {
+	case bool:
+		converted, err = strconv.ParseBool(strings.TrimSpace(value))
+	case int:
+		var parsed int64
+		parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 0)
+		converted = int(parsed)
+	case int8:
+		var parsed int64
+		parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 8)
+		converted = int8(parsed)
+	case int16:
+		var parsed int64
+		parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 16)
+		converted = int16(parsed)
+	case int32:
+		var parsed int64
+		parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		converted = int32(parsed)
+	case int64:
+		converted, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case uint:
+		var parsed uint64
+		parsed, err = strconv.ParseUint(strings.TrimSpace(value), 10, 0)
+		converted = uint(parsed)
+	case uint8:
+		var parsed uint64
+		parsed, err = strconv.ParseUint(strings.TrimSpace(value), 10, 8)
+		converted = uint8(parsed)
+	case uint16:
+		var parsed uint64
+		parsed, err = strconv.ParseUint(strings.TrimSpace(value), 10, 16)
+		converted = uint16(parsed)
+	case uint32:
+		var parsed uint64
+		parsed, err = strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		converted = uint32(parsed)
+	case uint64:
+		converted, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	case float32:
+		var parsed float64
+		parsed, err = strconv.ParseFloat(strings.TrimSpace(value), 32)
+		converted = float32(parsed)
+	case float64:
+		converted, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case []interface{}:
+		return coerceList(value, current)
+	case map[string]interface{}:
+		return nil, fmt.Errorf("cannot convert %q to a map", value)
+	default:
+		return value, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %q to %T: %w", value, existing, err)
+	}
+	return converted, nil
+}
+
+// coerceList splits value on commas into an array whose items have the
+// type of the first element of existing.
+func coerceList(value string, existing []interface{}) (interface{}, error) {
+	if len(value) == 0 {
+		return []interface{}{}, nil
+	}
+	var itemType interface{}
+	if len(existing) > 0 {
+		itemType = existing[0]
+	}
+	items := strings.Split(value, ",")
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		converted, err := coerceString(strings.TrimSpace(item), itemType)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = converted
+	}
+	return list, nil
+}
@@ -0,0 +1,202 @@
+package viperEx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceString(t *testing.T) {
+	cases := []struct {
+		value    string
+		existing interface{}
+		expected interface{}
+	}{
+		{"true", false, true},
+		{" 0 ", true, false},
+		{"5", 1, 5},
+		{"-5", int8(1), int8(-5)},
+		{"300", int16(1), int16(300)},
+		{"5", int32(1), int32(5)},
+		{"5", int64(1), int64(5)},
+		{"5", uint(1), uint(5)},
+		{"5", uint8(1), uint8(5)},
+		{"5", uint16(1), uint16(5)},
+		{"5", uint32(1), uint32(5)},
+		{"5", uint64(1), uint64(5)},
+		{"1.5", float32(1), float32(1.5)},
+		{"5", float64(1), float64(5)},
+		{"text", "old", "text"},
+		{"text", nil, "text"},
+		{"a, b", []interface{}{"x"}, []interface{}{"a", "b"}},
+		{"1,2", []interface{}{float64(0)}, []interface{}{float64(1), float64(2)}},
+		{"1,2", []interface{}{}, []interface{}{"1", "2"}},
+		{"", []interface{}{"x"}, []interface{}{}},
+	}
+	for _, tc := range cases {
+		actual, err := coerceString(tc.value, tc.existing)
+		require.NoError(t, err, tc.value)
+		assert.Equal(t, tc.expected, actual, tc.value)
+	}
+
+	failures := []struct {
+		value    string
+		existing interface{}
+	}{
+		{"yes please", true},
+		{"5.5", 1},
+		{"300", int8(1)},
+		{"-1", uint(1)},
+		{"heavy", float64(1)},
+		{"1,x", []interface{}{float64(0)}},
+		{"x", map[string]interface{}{}},
+	}
+	for _, tc := range failures {
+		_, err := coerceString(tc.value, tc.existing)
+		assert.Error(t, err, tc.value)
+	}
+}
+
+func TestUpdateFromEnv_TypeCoercion(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim), WithEnvTypeCoercion(), WithCreateMissing())
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs__0__weight", "5")
+	t.Setenv("nest__eggs__*__somestrings", "x,y")
+	t.Setenv("nest__countint", "42")
+	t.Setenv("nest__name", "brick")
+	t.Setenv("nest__created", "7")
+	_, err = myViperEx.UpdateFromEnv()
+	require.NoError(t, err)
+
+	val, _ := myViperEx.Find("nest__eggs__0__weight")
+	assert.Equal(t, float64(5), val)
+	val, _ = myViperEx.Find("nest__countint")
+	assert.Equal(t, float64(42), val)
+	val, _ = myViperEx.Find("nest__name")
+	assert.Equal(t, "brick", val)
+	for _, match := range myViperEx.FindAll("nest__eggs__*__somestrings") {
+		assert.Equal(t, []interface{}{"x", "y"}, match.Value, match.Key)
+	}
+	// nothing to take the type from
+	val, _ = myViperEx.Find("nest__created")
+	assert.Equal(t, "7", val)
+
+	// interface{} fields see the parsed type
+	type counted struct {
+		Nest struct {
+			CountInt interface{}
+		}
+	}
+	out := counted{}
+	err = myViperEx.Unmarshal(&out)
+	require.NoError(t, err)
+	assert.Equal(t, float64(42), out.Nest.CountInt)
+}
+
+func TestUpdateFromEnv_TypeCoercionErrors(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"enabled": true,
+			"weights": []interface{}{1, 2},
+			"count":   3,
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvTypeCoercion())
+	require.NoError(t, err)
+
+	t.Setenv("nest__enabled", "maybe")
+	t.Setenv("nest__weights", "1,heavy")
+	t.Setenv("nest__count", "4")
+	_, err = ve.UpdateFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nest__enabled")
+	assert.Contains(t, err.Error(), "maybe")
+	assert.Contains(t, err.Error(), "nest__weights")
+
+	// failed values are not applied, valid ones are
+	val, _ := ve.Find("nest__enabled")
+	assert.Equal(t, true, val)
+	val, _ = ve.Find("nest__weights")
+	assert.Equal(t, []interface{}{1, 2}, val)
+	val, _ = ve.Find("nest__count")
+	assert.Equal(t, 4, val)
+
+	// without coercion values stay strings
+	plain, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+	_, err = plain.UpdateFromEnv()
+	require.NoError(t, err)
+	val, _ = plain.Find("nest__enabled")
+	assert.Equal(t, "maybe", val)
+}
+
+func TestUpdateFromEnv_JSONValues(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim), WithEnvJSONValues())
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs", `[{"Name": "json0", "Weight": 1, "SomeStrings": ["a"]}, {"Name": "json1"}]`)
+	t.Setenv("nestedMap__eggs__bob", ` {"Weight": 77, "SomeValues": [{"Value": "v"}]}`)
+	t.Setenv("nest__masteregg__somestrings", `["x", "y"]`)
+	t.Setenv("nest__name", "not json")
+	_, err = myViperEx.UpdateFromEnv()
+	require.NoError(t, err)
+
+	// indistinguishable from data read from the config file
+	val, _ := myViperEx.Find("nest__eggs__0")
+	assert.Equal(t, map[string]interface{}{
+		"name":        "json0",
+		"weight":      float64(1),
+		"somestrings": []interface{}{"a"},
+	}, val)
+
+	settings := Settings{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+	require.Len(t, settings.Nest.Eggs, 2)
+	assert.Equal(t, "json1", settings.Nest.Eggs[1].Name)
+	assert.Equal(t, []string{"x", "y"}, settings.Nest.MasterEgg.SomeStrings)
+	assert.Equal(t, "not json", settings.Nest.Name)
+
+	mapSettings := SettingsWithNestedMap{}
+	err = myViperEx.Unmarshal(&mapSettings)
+	require.NoError(t, err)
+	assert.Equal(t, int32(77), mapSettings.NestedMap.Eggs["bob"].Weight)
+	assert.Equal(t, "v", mapSettings.NestedMap.Eggs["bob"].SomeValues[0].Value)
+	assert.Empty(t, mapSettings.NestedMap.Eggs["bob"].SomeStrings)
+}
+
+func TestUpdateFromEnv_JSONValuesWildcard(t *testing.T) {
+	settings := map[string]interface{}{
+		"eggs": []interface{}{
+			map[string]interface{}{"tags": []interface{}{}},
+			map[string]interface{}{"tags": []interface{}{}},
+		},
+		"name": "bob",
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvJSONValues(), WithEnvTypeCoercion())
+	require.NoError(t, err)
+
+	t.Setenv("eggs__*__tags", `{"Primary": "a"}`)
+	t.Setenv("name", `[not json`)
+	t.Setenv("eggs__0__broken", `{"a":`)
+	_, err = ve.UpdateFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "eggs__0__broken")
+
+	// every target gets its own copy
+	matches := ve.FindAll("eggs__*__tags")
+	require.Len(t, matches, 2)
+	matches[0].Value.(map[string]interface{})["primary"] = "changed"
+	val, _ := ve.Find("eggs__1__tags__primary")
+	assert.Equal(t, "a", val)
+}
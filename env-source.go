@@ -0,0 +1,140 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvSource supplies environment variables in the "key=value" form
+// returned by os.Environ.
+type EnvSource interface {
+	Environ() []string
+}
+
+// EnvSourceFunc adapts a function to an EnvSource.
+type EnvSourceFunc func() []string
+
+// Environ calls f.
+func (f EnvSourceFunc) Environ() []string {
+	return f()
+}
+
+// EnvMap is an EnvSource backed by a map of variable names to values.
+type EnvMap map[string]string
+
+// Environ returns the variables of m sorted by name.
+func (m EnvMap) Environ() []string {
+	environ := make([]string, 0, len(m))
+	for key, value := range m {
+		environ = append(environ, key+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// environ returns the variables of the configured EnvSource, or of the
+// process environment if none is configured.
+func (ve *ViperEx) environ() []string {
+	if ve.EnvSource == nil {
+		return os.Environ()
+	}
+	return ve.EnvSource.Environ()
+}
+
+// envVariable is an environment variable considered by UpdateFromEnv.
+type envVariable struct {
+	// name is the full variable name.
+	name string
+	// prefix is the env prefix the variable carries, if any.
+	prefix string
+	// key is the variable name without its prefix.
+	key   string
+	value string
+	// source is the precedence of the source the variable comes from,
+	// e.g. a dotenv file or the environment; higher sources win.
+	source int
+	// rank is the precedence of prefix within its source; higher ranks win.
+	rank int
+	// file is true if value is the path of a file holding the value.
+	file bool
+}
+
+// compare orders variables by precedence: by source, then by rank. It
+// returns a negative number if v is outranked by other, zero if they have
+// the same precedence, and a positive number otherwise.
+func (v envVariable) compare(other envVariable) int {
+	if v.source != other.source {
+		return v.source - other.source
+	}
+	return v.rank - other.rank
+}
+
+// orderEnvVariables keeps one variable per lowercased key and sorts them
+// into the order they must be applied: by precedence, so that higher
+// sources and ranks win, then by depth, so that a subtree is replaced
+// before the leaves beneath it are set, then by key. A variable of a higher
+// precedence replaces one of a lower precedence. Variables of the same
+// precedence whose keys only differ in case collide; the lexically last
+// name wins and the collision is returned.
+func (ve *ViperEx) orderEnvVariables(variables []envVariable) ([]envVariable, []CollidingKey) {
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].name < variables[j].name
+	})
+	winners := make(map[string]envVariable)
+	colliding := make(map[string][]string)
+	for _, variable := range variables {
+		key := strings.ToLower(variable.key)
+		winner, ok := winners[key]
+		switch {
+		case !ok || variable.compare(winner) > 0:
+			winners[key] = variable
+			colliding[key] = []string{variable.name}
+		case variable.compare(winner) == 0:
+			winners[key] = variable
+			colliding[key] = append(colliding[key], variable.name)
+		}
+	}
+	ordered := make([]envVariable, 0, len(winners))
+	var collisions []CollidingKey
+	for key, variable := range winners {
+		ordered = append(ordered, variable)
+		if names := colliding[key]; len(names) > 1 {
+			collisions = append(collisions, CollidingKey{Key: key, Names: names})
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if precedence := a.compare(b); precedence != 0 {
+			return precedence < 0
+		}
+		depthA, depthB := strings.Count(a.key, ve.KeyDelimiter), strings.Count(b.key, ve.KeyDelimiter)
+		if depthA != depthB {
+			return depthA < depthB
+		}
+		return strings.ToLower(a.key) < strings.ToLower(b.key)
+	})
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Key < collisions[j].Key
+	})
+	return ordered, collisions
+}
+
+// readValueFile returns the contents of the file at path without a single
+// trailing newline.
+func readValueFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := string(content)
+	if strings.HasSuffix(value, "\r\n") {
+		return strings.TrimSuffix(value, "\r\n"), nil
+	}
+	return strings.TrimSuffix(value, "\n"), nil
+}
@@ -0,0 +1,225 @@
+package viperEx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvMap(t *testing.T) {
+	t.Parallel()
+	env := EnvMap{"b": "2", "a": "1=one"}
+	assert.Equal(t, []string{"a=1=one", "b=2"}, env.Environ())
+}
+
+func TestUpdateFromEnv_EnvMapSource(t *testing.T) {
+	t.Parallel()
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"name": "straw",
+			"eggs": []interface{}{
+				map[string]interface{}{"weight": 1, "url": ""},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("APP"), WithEnvSource(EnvMap{
+		"APP_nest__name":          "brick",
+		"APP_nest__eggs__0__url":  "https://example.com/?a=b",
+		"nest__eggs__0__weight":   "5",
+		"OTHER_nest__eggs__0__ur": "x",
+	}))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 2)
+
+	val, _ := ve.Find("nest__name")
+	assert.Equal(t, "brick", val)
+	val, _ = ve.Find("nest__eggs__0__url")
+	assert.Equal(t, "https://example.com/?a=b", val)
+	val, _ = ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 1, val)
+}
+
+func TestUpdateFromEnv_EnvSourceFunc(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	source := EnvSourceFunc(func() []string {
+		calls++
+		return []string{"nest__name=brick", "malformed", "=empty"}
+	})
+	ve, err := New(map[string]interface{}{
+		"nest": map[string]interface{}{"name": "straw"},
+	}, WithDelimiter(keyDelim), WithEnvSource(source))
+	require.NoError(t, err)
+
+	_, err = ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	val, _ := ve.Find("nest__name")
+	assert.Equal(t, "brick", val)
+}
+
+func TestUpdateFromEnv_EnvPrefixes(t *testing.T) {
+	t.Parallel()
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost", "port": "5432", "name": "db"},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefixes("PLATFORM", "ORDERS_"),
+		WithEnvSource(EnvMap{
+			"ORDERS_db__host":   "orders.internal",
+			"PLATFORM_db__host": "platform.internal",
+			"PLATFORM_db__port": "6543",
+			"OTHER_db__name":    "other",
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PLATFORM_", "ORDERS_"}, ve.EnvPrefixes)
+
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 2)
+
+	val, _ := ve.Find("db__host")
+	assert.Equal(t, "orders.internal", val)
+	val, _ = ve.Find("db__port")
+	assert.Equal(t, "6543", val)
+	val, _ = ve.Find("db__name")
+	assert.Equal(t, "db", val)
+
+	_, err = New(settings, WithEnvPrefixes("APP", "_"))
+	assert.Error(t, err)
+}
+
+func TestUpdateFromEnv_EnvPrefixesLongestMatch(t *testing.T) {
+	t.Parallel()
+	settings := map[string]interface{}{
+		"db":  map[string]interface{}{"host": "localhost"},
+		"app": map[string]interface{}{"db": map[string]interface{}{"host": "localhost"}},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("IGNORED"),
+		WithEnvPrefixes("APP_DB", "APP"), WithStrictEnv(),
+		WithEnvSource(EnvMap{
+			"APP_db__host":     "app.internal",
+			"APP_DB_x__host":   "db.internal",
+			"IGNORED_db__host": "ignored.internal",
+		}))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.Error(t, err)
+	var unmatchedErr *UnmatchedEnvError
+	require.ErrorAs(t, err, &unmatchedErr)
+	require.Len(t, unmatchedErr.Unmatched, 1)
+	assert.Equal(t, "APP_DB_", unmatchedErr.Unmatched[0].Prefix)
+	assert.Equal(t, "x__host", unmatchedErr.Unmatched[0].Key)
+	assert.Contains(t, err.Error(), "APP_DB_x__host")
+	_, found := findApplied(report, "db__host")
+	assert.True(t, found)
+}
+
+func TestUpdateFromEnv_ParentsBeforeChildren(t *testing.T) {
+	t.Parallel()
+	for i := 0; i < 20; i++ {
+		ve, err := New(map[string]interface{}{
+			"nest": map[string]interface{}{
+				"eggs": []interface{}{map[string]interface{}{"weight": 1}},
+			},
+		}, WithDelimiter(keyDelim), WithEnvJSONValues(), WithEnvSource(EnvMap{
+			"nest__eggs__0__weight": "5",
+			"nest__eggs":            `[{"weight": 2}, {"weight": 3}]`,
+			"nest__eggs__1__weight": "7",
+		}))
+		require.NoError(t, err)
+
+		report, err := ve.UpdateFromEnv()
+		require.NoError(t, err)
+		require.Len(t, report.Applied, 3)
+		assert.Equal(t, "nest__eggs", report.Applied[0].Key)
+		assert.Equal(t, "nest__eggs__0__weight", report.Applied[1].Key)
+		assert.Equal(t, "nest__eggs__1__weight", report.Applied[2].Key)
+
+		val, _ := ve.Find("nest__eggs__0__weight")
+		assert.Equal(t, "5", val)
+		val, _ = ve.Find("nest__eggs__1__weight")
+		assert.Equal(t, "7", val)
+	}
+}
+
+func TestUpdateFromEnv_CaseCollisions(t *testing.T) {
+	t.Parallel()
+	for i := 0; i < 20; i++ {
+		ve, err := New(map[string]interface{}{
+			"nest": map[string]interface{}{"name": "straw"},
+		}, WithDelimiter(keyDelim), WithEnvPrefixes("BASE", "APP"), WithEnvSource(EnvMap{
+			"APP_NEST__name":  "upper",
+			"APP_nest__NAME":  "lower",
+			"BASE_nest__name": "base",
+		}))
+		require.NoError(t, err)
+
+		report, err := ve.UpdateFromEnv()
+		require.NoError(t, err)
+		require.Len(t, report.Applied, 1)
+		assert.Equal(t, "nest__NAME", report.Applied[0].Key)
+		assert.Equal(t, []CollidingKey{
+			{Key: "nest__name", Names: []string{"APP_NEST__name", "APP_nest__NAME"}},
+		}, report.Collisions)
+
+		val, _ := ve.Find("nest__name")
+		assert.Equal(t, "lower", val)
+	}
+}
+
+func TestUpdateFromEnv_FileSuffix(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "dbpw")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600))
+	hostFile := filepath.Join(dir, "host")
+	require.NoError(t, os.WriteFile(hostFile, []byte("db.internal\r\n"), 0o600))
+
+	settings := map[string]interface{}{
+		"db": map[string]interface{}{"password": "", "host": "localhost", "user": "sa"},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("APP"), WithEnvFileSuffix("_FILE"),
+		WithEnvSource(EnvMap{
+			"APP_db__password_FILE": passwordFile,
+			"APP_db__host_FILE":     hostFile,
+			"APP_db__user":          "admin",
+		}))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 3)
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, "s3cret", val)
+	val, _ = ve.Find("db__host")
+	assert.Equal(t, "db.internal", val)
+	val, _ = ve.Find("db__user")
+	assert.Equal(t, "admin", val)
+}
+
+func TestUpdateFromEnv_FileSuffixReadError(t *testing.T) {
+	t.Parallel()
+	missing := filepath.Join(t.TempDir(), "missing")
+	ve, err := New(map[string]interface{}{
+		"db": map[string]interface{}{"password": "default"},
+	}, WithDelimiter(keyDelim), WithEnvFileSuffix("_FILE"), WithEnvSource(EnvMap{
+		"db__password_FILE": missing,
+	}))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Contains(t, err.Error(), "db__password")
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, missing, report.Skipped[0].Value)
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, "default", val)
+}
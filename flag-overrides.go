@@ -0,0 +1,180 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// SetFlag is the name of the repeatable flag whose key=value arguments
+// override settings, as in --set nest__eggs__0__weight=5.
+const SetFlag = "set"
+
+// FlagError reports a command-line override that could not be applied.
+type FlagError struct {
+	// Flag is the flag as given, e.g. "--set nest__egs__0__weight=5".
+	Flag string
+	// Err describes why the override failed. Unknown paths wrap the same
+	// errors as UpdateReport.Unmatched reasons, e.g. ErrKeyNotFound.
+	Err error
+}
+
+func (e *FlagError) Error() string {
+	return fmt.Sprintf("flag %q: %v", e.Flag, e.Err)
+}
+
+func (e *FlagError) Unwrap() error {
+	return e.Err
+}
+
+// flagOverride is a single deep-path override taken from a flag.
+type flagOverride struct {
+	flag  string
+	key   string
+	value string
+}
+
+// UpdateFromArgs applies the command-line overrides in args and returns the
+// arguments it did not consume, in order, for the application's own flag
+// parsing. Two forms are recognized:
+//
+//	--set nest__eggs__0__weight=5    (also --set=..., repeatable)
+//	--nest.eggs.0.weight=5
+//
+// In the second form "." separates path segments in addition to the
+// KeyDelimiter, and only flags naming a path with at least two segments are
+// consumed. Its value must follow "=": a path-named flag without one, as in
+// --nest.on serve, is left for the application together with the argument
+// after it. Arguments after "--" are never consumed. Values are applied in
+// order, following the same rules as UpdateFromEnv, so that later flags win.
+// The overrides are applied atomically: if any flag is malformed or names an
+// unknown path, the settings are left untouched and the returned error
+// holds a *FlagError for each offending flag. On success AllSettings is
+// replaced by the updated copy.
+func (ve *ViperEx) UpdateFromArgs(args []string) ([]string, error) {
+	var overrides []flagOverride
+	var remaining []string
+	var errs []error
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !strings.HasPrefix(arg, "--") || (name != SetFlag && (!hasValue || !ve.isFlagPath(name))) {
+			remaining = append(remaining, arg)
+			continue
+		}
+		flag := arg
+		if !hasValue {
+			// only --set takes its value from the next argument
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+				errs = append(errs, &FlagError{Flag: flag, Err: errors.New("missing value")})
+				continue
+			}
+			i++
+			value = args[i]
+			flag = arg + " " + value
+		}
+		if name != SetFlag {
+			overrides = append(overrides, flagOverride{flag: flag, key: ve.flagKey(name), value: value})
+			continue
+		}
+		override, err := ve.parseSetFlag(flag, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		overrides = append(overrides, override)
+	}
+	if len(errs) > 0 {
+		return remaining, errors.Join(errs...)
+	}
+	return remaining, ve.applyFlagOverrides(overrides)
+}
+
+// UpdateFromFlagSet applies the overrides held by the parsed flags in
+// flags. Every changed flag whose name is a deep path, such as a flag
+// defined as "nest.eggs.0.weight", sets that path to the flag's value, in
+// lexical order. The key=value arguments of a changed SetFlag flag, which
+// is typically defined with flags.StringArray(SetFlag, nil, ...), are
+// applied afterwards in the order given. Errors and atomicity are the same
+// as for UpdateFromArgs.
+func (ve *ViperEx) UpdateFromFlagSet(flags *pflag.FlagSet) error {
+	var overrides []flagOverride
+	var errs []error
+	flags.Visit(func(f *pflag.Flag) {
+		if f.Name == SetFlag || !ve.isFlagPath(f.Name) {
+			return
+		}
+		overrides = append(overrides, flagOverride{
+			flag:  "--" + f.Name + "=" + f.Value.String(),
+			key:   ve.flagKey(f.Name),
+			value: f.Value.String(),
+		})
+	})
+	if f := flags.Lookup(SetFlag); f != nil && f.Changed {
+		values := []string{f.Value.String()}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			values = slice.GetSlice()
+		}
+		for _, value := range values {
+			override, err := ve.parseSetFlag("--"+SetFlag+" "+value, value)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			overrides = append(overrides, override)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return ve.applyFlagOverrides(overrides)
+}
+
+// isFlagPath reports whether the flag name is a deep path of at least two
+// segments.
+func (ve *ViperEx) isFlagPath(name string) bool {
+	return strings.Contains(name, ".") || strings.Contains(name, ve.KeyDelimiter)
+}
+
+// flagKey turns a flag name into a deep-path key.
+func (ve *ViperEx) flagKey(name string) string {
+	return strings.ReplaceAll(name, ".", ve.KeyDelimiter)
+}
+
+// parseSetFlag parses the key=value argument of a SetFlag flag.
+func (ve *ViperEx) parseSetFlag(flag string, argument string) (flagOverride, error) {
+	key, value, found := strings.Cut(argument, "=")
+	if !found || len(key) == 0 {
+		return flagOverride{}, &FlagError{Flag: flag, Err: errors.New("expected key=value")}
+	}
+	return flagOverride{flag: flag, key: key, value: value}, nil
+}
+
+// applyFlagOverrides applies the overrides in order, atomically.
+func (ve *ViperEx) applyFlagOverrides(overrides []flagOverride) error {
+	return ve.atomically(func() error {
+		var errs []error
+		for _, override := range overrides {
+			report := &UpdateReport{}
+			ve.updateFromString(override.key, override.value, report)
+			for _, skipped := range report.Skipped {
+				errs = append(errs, &FlagError{Flag: override.flag, Err: skipped.Err})
+			}
+			for _, unmatched := range report.Unmatched {
+				errs = append(errs, &FlagError{Flag: override.flag, Err: unmatched.Reason})
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,132 @@
+package viperEx
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFlagTestViperEx(t *testing.T) *ViperEx {
+	t.Helper()
+	ve, err := New(map[string]interface{}{
+		"name": "bob",
+		"nest": map[string]interface{}{
+			"name": "straw",
+			"eggs": []interface{}{
+				map[string]interface{}{"weight": 1},
+				map[string]interface{}{"weight": 2},
+			},
+		},
+	}, WithDelimiter(keyDelim), WithEnvTypeCoercion())
+	require.NoError(t, err)
+	return ve
+}
+
+func TestUpdateFromArgs(t *testing.T) {
+	t.Parallel()
+	ve := newFlagTestViperEx(t)
+
+	remaining, err := ve.UpdateFromArgs([]string{
+		"serve",
+		"--set", "nest__eggs__0__weight=5",
+		"--verbose",
+		"--set=nest__name=brick=red",
+		"--nest.eggs.1.weight=7",
+		"--nest__eggs__0__weight=6",
+		"-v",
+		"--",
+		"--set", "name=ignored",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"serve", "--verbose", "-v", "--", "--set", "name=ignored"}, remaining)
+
+	val, _ := ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 6, val)
+	val, _ = ve.Find("nest__eggs__1__weight")
+	assert.Equal(t, 7, val)
+	val, _ = ve.Find("nest__name")
+	assert.Equal(t, "brick=red", val)
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+
+	// a path-named flag takes its value after "=" only, so a following
+	// subcommand is never swallowed
+	remaining, err = ve.UpdateFromArgs([]string{"--nest.name", "serve", "--nest.eggs.0.weight=8"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--nest.name", "serve"}, remaining)
+	val, _ = ve.Find("nest__name")
+	assert.Equal(t, "brick=red", val)
+	val, _ = ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 8, val)
+}
+
+func TestUpdateFromArgs_Errors(t *testing.T) {
+	t.Parallel()
+	ve := newFlagTestViperEx(t)
+
+	_, err := ve.UpdateFromArgs([]string{
+		"--set", "nest__name=brick",
+		"--set", "nest__egs__0__weight=5",
+		"--nest.eggs.5.weight=5",
+		"--nest.eggs.0.weight=heavy",
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	assert.Contains(t, err.Error(), `"--set nest__egs__0__weight=5"`)
+	assert.Contains(t, err.Error(), `"--nest.eggs.5.weight=5"`)
+	assert.Contains(t, err.Error(), `"--nest.eggs.0.weight=heavy"`)
+	var flagErr *FlagError
+	require.ErrorAs(t, err, &flagErr)
+	assert.Equal(t, "--set nest__egs__0__weight=5", flagErr.Flag)
+
+	// nothing was applied
+	val, _ := ve.Find("nest__name")
+	assert.Equal(t, "straw", val)
+
+	for _, args := range [][]string{
+		{"--set"},
+		{"--set", "nest__name"},
+		{"--set=", "nest__name=brick"},
+		{"--set", "--verbose"},
+	} {
+		_, err := ve.UpdateFromArgs(args)
+		require.Error(t, err, args)
+		require.ErrorAs(t, err, &flagErr)
+		assert.Equal(t, args[0], flagErr.Flag[:len(args[0])])
+	}
+}
+
+func TestUpdateFromFlagSet(t *testing.T) {
+	t.Parallel()
+	ve := newFlagTestViperEx(t)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringArray(SetFlag, nil, "override a setting")
+	flags.Int("nest.eggs.0.weight", 0, "weight of the first egg")
+	flags.String("nest.name", "", "name of the nest")
+	flags.Bool("verbose", false, "verbose output")
+	require.NoError(t, flags.Parse([]string{
+		"--nest.eggs.0.weight=5",
+		"--set", "nest__eggs__1__weight=8",
+		"--set", "nest__eggs__0__weight=9",
+		"--verbose",
+	}))
+
+	require.NoError(t, ve.UpdateFromFlagSet(flags))
+	val, _ := ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 9, val)
+	val, _ = ve.Find("nest__eggs__1__weight")
+	assert.Equal(t, 8, val)
+	// unchanged flags do not override
+	val, _ = ve.Find("nest__name")
+	assert.Equal(t, "straw", val)
+
+	flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("nest.missing", "", "")
+	require.NoError(t, flags.Parse([]string{"--nest.missing=x"}))
+	err := ve.UpdateFromFlagSet(flags)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorContains(t, err, "--nest.missing=x")
+}
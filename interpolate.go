@@ -0,0 +1,219 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// referenceOpen and referenceClose delimit a reference in a value.
+	referenceOpen  = "${"
+	referenceClose = "}"
+	// escapedReferenceOpen stands for a literal "${".
+	escapedReferenceOpen = "$${"
+	// envReferencePrefix marks a reference to an environment variable.
+	envReferencePrefix = "env:"
+)
+
+var (
+	// ErrUnresolvedReference reports a reference to a path or environment
+	// variable that does not exist, or to a value that failed to resolve.
+	ErrUnresolvedReference = errors.New("unresolved reference")
+	// ErrReferenceCycle reports a reference that leads back to itself.
+	ErrReferenceCycle = errors.New("reference cycle")
+)
+
+// interpolation states of a path
+const (
+	interpolating = iota + 1
+	interpolated
+	interpolationFailed
+)
+
+// interpolator resolves the references of a single Interpolate call.
+type interpolator struct {
+	ve  *ViperEx
+	env map[string]string
+	// state tracks each visited path by its deep-path key.
+	state map[string]int
+	// marks are the sensitive marks, moved along with the values copied
+	// from sensitive paths.
+	marks sensitiveMarks
+	errs  []error
+}
+
+// Interpolate resolves references inside string values, typically after
+// all overrides have been applied. ${hosts__api} is replaced by the value at
+// the deep-path key hosts__api, and ${env:HOME} by the environment variable
+// HOME as supplied by the EnvSource. A value that consists of a single
+// reference to a path takes the referenced value with its type, so
+// "${nest__eggs}" copies a whole array; references embedded in a longer
+// string must resolve to scalars. Referenced values are interpolated first.
+// Copies of sensitive values, and strings that embed them, are sensitive
+// too, see RedactedSettings.
+// Write $${ for a literal "${".
+// Interpolation is atomic: if a reference cannot be resolved or is part of
+// a cycle, the settings are left untouched and the returned error lists
+// every failing path, wrapping ErrUnresolvedReference or ErrReferenceCycle.
+// On success AllSettings is replaced by the interpolated copy.
+func (ve *ViperEx) Interpolate() error {
+	return ve.atomically(func() error {
+		in := &interpolator{
+			ve:    ve,
+			env:   make(map[string]string),
+			state: make(map[string]int),
+			marks: ve.sensitive,
+		}
+		for _, element := range ve.environ() {
+			if name, value, found := strings.Cut(element, "="); found {
+				in.env[name] = value
+			}
+		}
+		for _, seg := range childKeys(ve.AllSettings) {
+			in.resolve([]pathSegment{seg})
+		}
+		if len(in.errs) > 0 {
+			return errors.Join(in.errs...)
+		}
+		ve.sensitive = in.marks
+		return nil
+	})
+}
+
+// resolve interpolates the value at the concrete path, stores the result
+// and returns it. It fails if the value, or any value below it, cannot be
+// resolved.
+func (in *interpolator) resolve(path []pathSegment) (interface{}, error) {
+	key := in.ve.joinPath(path)
+	switch in.state[key] {
+	case interpolating:
+		return nil, ErrReferenceCycle
+	case interpolationFailed:
+		return nil, ErrUnresolvedReference
+	}
+	value, _ := lookupPath(in.ve.AllSettings, path)
+	if in.state[key] == interpolated {
+		return value, nil
+	}
+	in.state[key] = interpolating
+	var err error
+	switch node := value.(type) {
+	case map[string]interface{}, []interface{}:
+		for _, seg := range childKeys(node) {
+			if _, childErr := in.resolve(append(path[:len(path):len(path)], seg)); childErr != nil {
+				err = ErrUnresolvedReference
+			}
+		}
+	case string:
+		value, err = in.interpolateString(path, node)
+		if err == nil {
+			in.ve.setIn(in.ve.AllSettings, path, 0, value)
+		}
+	}
+	if err != nil {
+		in.state[key] = interpolationFailed
+		return nil, err
+	}
+	in.state[key] = interpolated
+	return value, nil
+}
+
+// interpolateString resolves the references in the value at the concrete
+// path and marks the result as sensitive if it copies or embeds a sensitive
+// value. Errors are recorded against the path.
+func (in *interpolator) interpolateString(path []pathSegment, value string) (interface{}, error) {
+	if !strings.Contains(value, referenceOpen) {
+		return value, nil
+	}
+	key := in.ve.joinPath(path)
+	if strings.HasPrefix(value, referenceOpen) && strings.Index(value, referenceClose) == len(value)-1 {
+		// a whole-value reference keeps the type of the referenced value
+		resolved, refPath, err := in.reference(key, value[len(referenceOpen):len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+		in.marks = append(in.marks.without(path), in.marks.rebased(refPath, path)...)
+		return normalizeValue(resolved), nil
+	}
+	sensitive := false
+	var sb strings.Builder
+	for i := 0; i < len(value); {
+		switch {
+		case strings.HasPrefix(value[i:], escapedReferenceOpen):
+			sb.WriteString(referenceOpen)
+			i += len(escapedReferenceOpen)
+		case strings.HasPrefix(value[i:], referenceOpen):
+			end := strings.Index(value[i:], referenceClose)
+			if end < 0 {
+				return nil, in.fail(key, fmt.Errorf("unterminated reference %q", value[i:]))
+			}
+			ref := value[i+len(referenceOpen) : i+end]
+			resolved, refPath, err := in.reference(key, ref)
+			if err != nil {
+				return nil, err
+			}
+			if refPath != nil && in.marks.holds(in.ve.AllSettings, refPath) {
+				sensitive = true
+			}
+			switch resolved.(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, in.fail(key, fmt.Errorf("reference %q: cannot embed a %T in a string", ref, resolved))
+			}
+			if resolved != nil {
+				fmt.Fprint(&sb, resolved)
+			}
+			i += end + len(referenceClose)
+		default:
+			sb.WriteByte(value[i])
+			i++
+		}
+	}
+	in.marks = in.marks.without(path)
+	if sensitive {
+		in.marks = append(in.marks, sensitiveMark{path: path, value: sb.String()})
+	}
+	return sb.String(), nil
+}
+
+// reference returns the value ref refers to and, for a reference to a
+// path, its concrete path. Errors are recorded against key, the path
+// holding the reference.
+func (in *interpolator) reference(key string, ref string) (interface{}, []pathSegment, error) {
+	if name, ok := strings.CutPrefix(ref, envReferencePrefix); ok {
+		value, ok := in.env[name]
+		if !ok {
+			return nil, nil, in.fail(key, fmt.Errorf("reference %q: %w", ref, ErrUnresolvedReference))
+		}
+		return value, nil, nil
+	}
+	path, ok := in.ve.splitKey(ref)
+	if !ok || hasWildcard(path) {
+		return nil, nil, in.fail(key, fmt.Errorf("reference %q: %w: %w", ref, ErrUnresolvedReference, ErrInvalidKey))
+	}
+	expanded := expandPath(in.ve.AllSettings, path, 0)
+	if len(expanded) == 0 {
+		return nil, nil, in.fail(key, fmt.Errorf("reference %q: %w: %w", ref, ErrUnresolvedReference, in.ve.diagnose(path)))
+	}
+	concrete, ok := concretePath(in.ve.AllSettings, expanded[0])
+	if !ok {
+		return nil, nil, in.fail(key, fmt.Errorf("reference %q: %w: %w", ref, ErrUnresolvedReference, in.ve.diagnose(path)))
+	}
+	value, err := in.resolve(concrete)
+	if err != nil {
+		return nil, nil, in.fail(key, fmt.Errorf("reference %q: %w", ref, err))
+	}
+	return value, concrete, nil
+}
+
+// fail records err against the path key and returns it.
+func (in *interpolator) fail(key string, err error) error {
+	err = fmt.Errorf("interpolate %q: %w", key, err)
+	in.errs = append(in.errs, err)
+	return err
+}
@@ -0,0 +1,92 @@
+package viperEx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Parallel()
+	ve, err := New(map[string]interface{}{
+		"hosts": map[string]interface{}{
+			"api":  "${hosts__base}:${ports__api}",
+			"base": "api.internal",
+		},
+		"ports": map[string]interface{}{"api": 8080},
+		"uri":   "https://${hosts__api}/v1",
+		"data":  "${env:HOME}/data",
+		"port":  "${ports__api}",
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{
+				map[string]interface{}{"name": "bob", "weight": 5},
+			},
+			"heaviest": "${nest__eggs[name=bob]__weight}",
+			"copy":     "${nest__eggs}",
+		},
+		"literal": "$${hosts__api} costs $$5",
+		"plain":   "no references",
+	}, WithDelimiter(keyDelim), WithEnvSource(EnvMap{"HOME": "/home/bob"}))
+	require.NoError(t, err)
+
+	require.NoError(t, ve.Interpolate())
+	assert.Equal(t, "api.internal:8080", ve.AllSettings["hosts"].(map[string]interface{})["api"])
+	assert.Equal(t, "https://api.internal:8080/v1", ve.AllSettings["uri"])
+	assert.Equal(t, "/home/bob/data", ve.AllSettings["data"])
+	assert.Equal(t, 8080, ve.AllSettings["port"])
+	assert.Equal(t, "${hosts__api} costs $$5", ve.AllSettings["literal"])
+	assert.Equal(t, "no references", ve.AllSettings["plain"])
+
+	val, _ := ve.Find("nest__heaviest")
+	assert.Equal(t, 5, val)
+	val, _ = ve.Find("nest__copy__0__name")
+	assert.Equal(t, "bob", val)
+
+	// the copy is independent of the original
+	ve.UpdateDeepPath("nest__copy__0__name", "alice")
+	val, _ = ve.Find("nest__eggs__0__name")
+	assert.Equal(t, "bob", val)
+}
+
+func TestInterpolate_Errors(t *testing.T) {
+	t.Parallel()
+	settings := map[string]interface{}{
+		"a":       "${b}",
+		"b":       map[string]interface{}{"x": "${a}"},
+		"missing": "https://${hosts__api}/v1",
+		"env":     "${env:NOT_SET}",
+		"embed":   "eggs: ${nest__eggs}",
+		"open":    "${never closed",
+		"ok":      "fine",
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{"egg"},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvSource(EnvMap{}))
+	require.NoError(t, err)
+
+	err = ve.Interpolate()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrReferenceCycle)
+	assert.ErrorIs(t, err, ErrUnresolvedReference)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Contains(t, err.Error(), `interpolate "b__x": reference "a": reference cycle`)
+	assert.Contains(t, err.Error(), `interpolate "missing": reference "hosts__api"`)
+	assert.Contains(t, err.Error(), `interpolate "env": reference "env:NOT_SET"`)
+	assert.Contains(t, err.Error(), `interpolate "embed"`)
+	assert.Contains(t, err.Error(), `interpolate "open"`)
+	assert.NotContains(t, err.Error(), `"ok"`)
+
+	// nothing was changed
+	assert.Equal(t, "${b}", ve.AllSettings["a"])
+}
+
+func TestInterpolate_SelfReference(t *testing.T) {
+	t.Parallel()
+	ve, err := New(map[string]interface{}{
+		"nest": map[string]interface{}{"self": "${nest}"},
+	}, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+	assert.ErrorIs(t, ve.Interpolate(), ErrReferenceCycle)
+}
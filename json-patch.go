@@ -0,0 +1,332 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PatchError reports the RFC 6902 JSON Patch operation that could not be
+// applied.
+type PatchError struct {
+	// Index is the zero-based position of the operation in the patch.
+	Index int
+	// Op is the operation name, e.g. "replace".
+	Op string
+	// Path is the JSON Pointer the operation targets.
+	Path string
+	// Err describes why the operation failed.
+	Err error
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("json patch operation %d (%s %q): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// patchOperation is the wire format of a single JSON Patch operation.
+// Value is kept raw so that an explicit null can be told apart from a
+// missing value.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch document (add, remove,
+// replace, move, copy and test operations) to the settings. Paths are JSON
+// Pointers, see FindPointer. The patch is applied atomically: if any
+// operation fails, including a failing test, the settings are left
+// untouched and a *PatchError naming the operation is returned. On success
+// AllSettings is replaced by the patched copy.
+func (ve *ViperEx) ApplyJSONPatch(patch []byte) error {
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return fmt.Errorf("json patch: %w", err)
+	}
+	doc := interface{}(normalizeSettings(ve.AllSettings))
+	marks := ve.sensitive
+	for i, operation := range operations {
+		next := marks.patched(doc, operation)
+		var err error
+		doc, err = applyPatchOperation(doc, operation)
+		if err != nil {
+			patchErr := &PatchError{Index: i, Op: operation.Op, Err: err}
+			if operation.Path != nil {
+				patchErr.Path = *operation.Path
+			}
+			return patchErr
+		}
+		marks = next
+	}
+	patched, ok := doc.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("json patch: result is a %T, not an object", doc)
+	}
+	ve.AllSettings = patched
+	ve.sensitive = marks
+	return nil
+}
+
+// applyPatchOperation applies a single operation to doc and returns the
+// resulting document.
+func applyPatchOperation(doc interface{}, operation patchOperation) (interface{}, error) {
+	if operation.Path == nil {
+		return doc, errors.New("missing path")
+	}
+	path, err := parsePointer(*operation.Path)
+	if err != nil {
+		return doc, err
+	}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return doc, errors.New("missing value")
+		}
+		var value interface{}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return doc, err
+		}
+		value = normalizeValue(value)
+		switch operation.Op {
+		case "add":
+			return patchAdd(doc, path, value)
+		case "replace":
+			return patchReplace(doc, path, value)
+		default:
+			return doc, patchTest(doc, path, value)
+		}
+	case "remove":
+		doc, _, err = patchRemove(doc, path)
+		return doc, err
+	case "move", "copy":
+		if operation.From == nil {
+			return doc, errors.New("missing from")
+		}
+		from, err := parsePointer(*operation.From)
+		if err != nil {
+			return doc, err
+		}
+		if operation.Op == "copy" {
+			value, err := patchGet(doc, from)
+			if err != nil {
+				return doc, err
+			}
+			return patchAdd(doc, path, normalizeValue(value))
+		}
+		if isProperPrefix(from, path) {
+			return doc, errors.New("cannot move a value into one of its children")
+		}
+		remaining, value, err := patchRemove(doc, from)
+		if err != nil {
+			return doc, err
+		}
+		return patchAdd(remaining, path, value)
+	default:
+		return doc, fmt.Errorf("unknown operation %q", operation.Op)
+	}
+}
+
+// patchGet returns the value at path, or an error if it does not exist.
+func patchGet(doc interface{}, path []pathSegment) (interface{}, error) {
+	value := doc
+	for _, seg := range path {
+		child, err := patchStep(value, seg.key)
+		if err != nil {
+			return nil, err
+		}
+		value = child
+	}
+	return value, nil
+}
+
+// patchStep returns the child of node addressed by key. Array indexes are
+// checked with patchIndex, so every segment of a path follows RFC 6901.
+func patchStep(node interface{}, key string) (interface{}, error) {
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if child, ok := container[key]; ok {
+			return child, nil
+		}
+	case []interface{}:
+		idx, err := patchIndex(key, len(container))
+		if err != nil {
+			return nil, err
+		}
+		return container[idx], nil
+	}
+	return nil, fmt.Errorf("path segment %q not found", key)
+}
+
+// patchAdd implements the add operation: map members are added or
+// replaced, array elements are inserted, and "-" appends to an array.
+func patchAdd(doc interface{}, path []pathSegment, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modifyParent(doc, path, 0, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			idx := len(container)
+			if key != "-" {
+				var err error
+				idx, err = patchIndex(key, len(container)+1)
+				if err != nil {
+					return parent, err
+				}
+			}
+			inserted := make([]interface{}, 0, len(container)+1)
+			inserted = append(inserted, container[:idx]...)
+			inserted = append(inserted, value)
+			inserted = append(inserted, container[idx:]...)
+			return inserted, nil
+		}
+		return parent, fmt.Errorf("cannot add %q to a %T", key, parent)
+	})
+}
+
+// patchReplace implements the replace operation: the target must exist.
+func patchReplace(doc interface{}, path []pathSegment, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modifyParent(doc, path, 0, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[key]; !ok {
+				return parent, fmt.Errorf("path segment %q not found", key)
+			}
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			idx, err := patchIndex(key, len(container))
+			if err != nil {
+				return parent, err
+			}
+			container[idx] = value
+			return container, nil
+		}
+		return parent, fmt.Errorf("cannot replace %q in a %T", key, parent)
+	})
+}
+
+// patchRemove implements the remove operation and also returns the value
+// that was removed.
+func patchRemove(doc interface{}, path []pathSegment) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return doc, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	doc, err := modifyParent(doc, path, 0, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			value, ok := container[key]
+			if !ok {
+				return parent, fmt.Errorf("path segment %q not found", key)
+			}
+			removed = value
+			delete(container, key)
+			return container, nil
+		case []interface{}:
+			idx, err := patchIndex(key, len(container))
+			if err != nil {
+				return parent, err
+			}
+			removed = container[idx]
+			spliced := make([]interface{}, 0, len(container)-1)
+			spliced = append(spliced, container[:idx]...)
+			spliced = append(spliced, container[idx+1:]...)
+			return spliced, nil
+		}
+		return parent, fmt.Errorf("cannot remove %q from a %T", key, parent)
+	})
+	return doc, removed, err
+}
+
+// patchTest implements the test operation using JSON equality.
+func patchTest(doc interface{}, path []pathSegment, value interface{}) error {
+	actual, err := patchGet(doc, path)
+	if err != nil {
+		return err
+	}
+	actualJSON, err := json.Marshal(actual)
+	if err != nil {
+		return err
+	}
+	expectedJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	// json.Marshal sorts map keys, so equal values encode identically
+	if !bytes.Equal(actualJSON, expectedJSON) {
+		return fmt.Errorf("test failed: value is %s, expected %s", actualJSON, expectedJSON)
+	}
+	return nil
+}
+
+// modifyParent walks node to the container holding the last segment of
+// path and lets fn change it. The container fn returns is stored back into
+// its own parent, which lets fn grow or shrink arrays.
+func modifyParent(node interface{}, path []pathSegment, depth int, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if depth == len(path)-1 {
+		return fn(node, path[depth].key)
+	}
+	key := path[depth].key
+	child, err := patchStep(node, key)
+	if err != nil {
+		return node, err
+	}
+	newChild, err := modifyParent(child, path, depth+1, fn)
+	if err != nil {
+		return node, err
+	}
+	switch container := node.(type) {
+	case map[string]interface{}:
+		container[key] = newChild
+	case []interface{}:
+		// patchStep has validated the index
+		idx, _ := strconv.Atoi(key)
+		container[idx] = newChild
+	}
+	return node, nil
+}
+
+// patchIndex parses an RFC 6901 array index, which must be "0" or have no
+// leading zeros, and checks that it is below limit.
+func patchIndex(key string, limit int) (int, error) {
+	if !isPointerIndex(key) {
+		return 0, fmt.Errorf("invalid array index %q", key)
+	}
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx >= limit {
+		return 0, fmt.Errorf("array index %q out of range", key)
+	}
+	return idx, nil
+}
+
+// isProperPrefix reports whether prefix is a proper prefix of path.
+func isProperPrefix(prefix []pathSegment, path []pathSegment) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i, seg := range prefix {
+		if seg.key != path[i].key {
+			return false
+		}
+	}
+	return true
+}
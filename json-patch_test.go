@@ -0,0 +1,128 @@
+package viperEx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPatchTestViperEx(t *testing.T) *ViperEx {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim))
+	require.NoError(t, err)
+	return myViperEx
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	myViperEx := newPatchTestViperEx(t)
+
+	err := myViperEx.ApplyJSONPatch([]byte(`[
+		{"op": "test", "path": "/nest/name", "value": "straw"},
+		{"op": "replace", "path": "/nest/name", "value": "brick"},
+		{"op": "add", "path": "/nest/eggs/0/somestrings/1", "value": "inserted"},
+		{"op": "add", "path": "/nest/tags/-", "value": "B"},
+		{"op": "add", "path": "/Nest/NewEgg", "value": {"Name": "fresh", "Weight": 1}},
+		{"op": "remove", "path": "/nestedmap/eggs/betty"},
+		{"op": "copy", "from": "/masteregg", "path": "/nestedmap/eggs/carl"},
+		{"op": "move", "from": "/nest/eggs/1", "path": "/nest/eggs/0"},
+		{"op": "replace", "path": "/nestedmap/eggs/carl/weight", "value": 99},
+		{"op": "test", "path": "/nest/neWegg", "value": {"weight": 1, "name": "fresh"}}
+	]`))
+	require.NoError(t, err)
+
+	settings := Settings{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+	assert.Equal(t, "brick", settings.Nest.Name)
+	assert.Equal(t, []string{"A", "B"}, settings.Nest.Tags)
+	require.Len(t, settings.Nest.Eggs, 2)
+	assert.Equal(t, int32(13), settings.Nest.Eggs[0].Weight)
+	assert.Equal(t, []string{"a", "inserted", "b", "c"}, settings.Nest.Eggs[1].SomeStrings)
+
+	val, found := myViperEx.Find("nest__newegg__name")
+	assert.True(t, found)
+	assert.Equal(t, "fresh", val)
+
+	mapSettings := SettingsWithNestedMap{}
+	err = myViperEx.Unmarshal(&mapSettings)
+	require.NoError(t, err)
+	assert.NotContains(t, mapSettings.NestedMap.Eggs, "betty")
+	assert.Equal(t, int32(99), mapSettings.NestedMap.Eggs["carl"].Weight)
+	// the copy is independent of its source
+	assert.Equal(t, int32(100), mapSettings.MasterEgg.Weight)
+	assert.Equal(t, "bob", mapSettings.NestedMap.Eggs["carl"].Name)
+}
+
+func TestApplyJSONPatch_Atomic(t *testing.T) {
+	cases := []struct {
+		name  string
+		patch string
+		index int
+		op    string
+	}{
+		{"failing test", `[
+			{"op": "replace", "path": "/name", "value": "changed"},
+			{"op": "test", "path": "/nest/name", "value": "brick"}
+		]`, 1, "test"},
+		{"missing path", `[
+			{"op": "replace", "path": "/name", "value": "changed"},
+			{"op": "replace", "path": "/nest/junk", "value": 1}
+		]`, 1, "replace"},
+		{"missing parent", `[{"op": "add", "path": "/junk/a", "value": 1}]`, 0, "add"},
+		{"index out of range", `[{"op": "add", "path": "/nest/tags/5", "value": 1}]`, 0, "add"},
+		{"leading zero index", `[{"op": "remove", "path": "/nest/tags/00"}]`, 0, "remove"},
+		{"leading zero inner index", `[{"op": "replace", "path": "/nest/eggs/01/name", "value": "x"}]`, 0, "replace"},
+		{"signed inner index", `[{"op": "test", "path": "/nest/eggs/+0/name", "value": "x"}]`, 0, "test"},
+		{"leading zero from index", `[{"op": "copy", "from": "/nest/eggs/00/name", "path": "/name"}]`, 0, "copy"},
+		{"remove missing", `[{"op": "remove", "path": "/nest/junk"}]`, 0, "remove"},
+		{"move into child", `[{"op": "move", "from": "/nest", "path": "/nest/child"}]`, 0, "move"},
+		{"missing value", `[{"op": "add", "path": "/name"}]`, 0, "add"},
+		{"missing from", `[{"op": "copy", "path": "/name"}]`, 0, "copy"},
+		{"unknown op", `[{"op": "merge", "path": "/name", "value": 1}]`, 0, "merge"},
+		{"bad pointer", `[{"op": "remove", "path": "name"}]`, 0, "remove"},
+		{"root scalar", `[{"op": "replace", "path": "", "value": 1}]`, -1, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			myViperEx := newPatchTestViperEx(t)
+			before := prettyJSON(myViperEx.AllSettings)
+
+			err := myViperEx.ApplyJSONPatch([]byte(tc.patch))
+			require.Error(t, err)
+			assert.Equal(t, before, prettyJSON(myViperEx.AllSettings))
+
+			var patchErr *PatchError
+			if tc.index < 0 {
+				assert.False(t, errors.As(err, &patchErr))
+				return
+			}
+			require.True(t, errors.As(err, &patchErr), err.Error())
+			assert.Equal(t, tc.index, patchErr.Index)
+			assert.Equal(t, tc.op, patchErr.Op)
+			assert.Contains(t, err.Error(), tc.op)
+		})
+	}
+
+	myViperEx := newPatchTestViperEx(t)
+	assert.Error(t, myViperEx.ApplyJSONPatch([]byte(`{"op": "add"}`)))
+}
+
+func TestApplyJSONPatch_Root(t *testing.T) {
+	myViperEx := newPatchTestViperEx(t)
+
+	err := myViperEx.ApplyJSONPatch([]byte(`[
+		{"op": "replace", "path": "", "value": {"Name": "root"}},
+		{"op": "add", "path": "/null", "value": null},
+		{"op": "test", "path": "/null", "value": null}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "root", "null": nil}, myViperEx.AllSettings)
+
+	err = myViperEx.ApplyJSONPatch([]byte(`[{"op": "remove", "path": ""}]`))
+	assert.Error(t, err)
+}
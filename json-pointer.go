@@ -0,0 +1,91 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pointerUnescaper decodes RFC 6901 reference tokens. The replacer works in
+// a single pass, so "~01" becomes "~1" and not "/".
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// FindPointer returns the value at the given RFC 6901 JSON Pointer and true
+// if found, or nil and false if the pointer is invalid or the path does not
+// exist. The empty pointer "" refers to the whole settings map.
+// Reference tokens are lowercased to match the normalized settings; "*" and
+// selectors have no special meaning.
+func (ve *ViperEx) FindPointer(pointer string) (interface{}, bool) {
+	path, err := parsePointer(pointer)
+	if err != nil {
+		return nil, false
+	}
+	if len(path) == 0 {
+		return ve.AllSettings, true
+	}
+	deepestEntity := ve.deepSearch(ve.AllSettings, path[:len(path)-1])
+	return stepInto(deepestEntity, path[len(path)-1])
+}
+
+// UpdatePointer updates the value at the given RFC 6901 JSON Pointer,
+// following the same rules as UpdateDeepPath. It returns false if the
+// pointer is invalid, refers to the whole document, or does not exist.
+func (ve *ViperEx) UpdatePointer(pointer string, value interface{}) bool {
+	path, err := parsePointer(pointer)
+	if err != nil || len(path) == 0 {
+		return false
+	}
+	_, ok := ve.setIn(ve.AllSettings, path, 0, value)
+	return ok
+}
+
+// RemovePointer removes the value at the given RFC 6901 JSON Pointer,
+// following the same rules as RemoveDeepPath. It returns false if the
+// pointer is invalid, refers to the whole document, or does not exist.
+func (ve *ViperEx) RemovePointer(pointer string) bool {
+	path, err := parsePointer(pointer)
+	if err != nil || len(path) == 0 {
+		return false
+	}
+	return ve.removePath(path)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into literal, lowercased
+// path segments whose array indexes are validated strictly. The empty
+// pointer yields an empty path.
+func parsePointer(pointer string) ([]pathSegment, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("json pointer %q must start with \"/\"", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	path := make([]pathSegment, len(tokens))
+	for i, token := range tokens {
+		if err := checkPointerEscapes(token); err != nil {
+			return nil, fmt.Errorf("json pointer %q: %w", pointer, err)
+		}
+		path[i] = pointerSegment(strings.ToLower(pointerUnescaper.Replace(token)))
+	}
+	return path, nil
+}
+
+// checkPointerEscapes verifies that every "~" in token is followed by "0"
+// or "1".
+func checkPointerEscapes(token string) error {
+	for i := 0; i < len(token); i++ {
+		if token[i] != '~' {
+			continue
+		}
+		if i+1 >= len(token) || (token[i+1] != '0' && token[i+1] != '1') {
+			return fmt.Errorf("invalid escape in reference token %q", token)
+		}
+		i++
+	}
+	return nil
+}
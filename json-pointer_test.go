@@ -0,0 +1,164 @@
+package viperEx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePointer(t *testing.T) {
+	path, err := parsePointer("")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	path, err = parsePointer("/Nest/eggs/0/a~1b/m~0n/~01/")
+	require.NoError(t, err)
+	assert.Equal(t, []pathSegment{
+		pointerSegment("nest"),
+		pointerSegment("eggs"),
+		pointerSegment("0"),
+		pointerSegment("a/b"),
+		pointerSegment("m~n"),
+		pointerSegment("~1"),
+		pointerSegment(""),
+	}, path)
+
+	for _, invalid := range []string{"nest", "/a~", "/a~2", "/~x"} {
+		_, err = parsePointer(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{
+				map[string]interface{}{"weight": 1},
+			},
+		},
+		"routes": map[string]interface{}{
+			"/api/v1": "backend",
+			"a__b":    "delimited",
+			"*":       "star",
+			"til~de":  "tilde",
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	val, found := ve.FindPointer("/nest/eggs/0/weight")
+	assert.True(t, found)
+	assert.Equal(t, 1, val)
+
+	// keys that cannot be expressed as delimiter paths
+	val, found = ve.FindPointer("/routes/~1api~1v1")
+	assert.True(t, found)
+	assert.Equal(t, "backend", val)
+	val, found = ve.FindPointer("/routes/a__b")
+	assert.True(t, found)
+	assert.Equal(t, "delimited", val)
+	val, found = ve.FindPointer("/routes/til~0de")
+	assert.True(t, found)
+	assert.Equal(t, "tilde", val)
+
+	// "*" is a literal key in a pointer
+	val, found = ve.FindPointer("/routes/*")
+	assert.True(t, found)
+	assert.Equal(t, "star", val)
+
+	val, found = ve.FindPointer("")
+	assert.True(t, found)
+	assert.Equal(t, ve.AllSettings, val)
+
+	_, found = ve.FindPointer("/nest/eggs/1")
+	assert.False(t, found)
+	_, found = ve.FindPointer("nest")
+	assert.False(t, found)
+
+	assert.True(t, ve.UpdatePointer("/Nest/Eggs/0/Weight", 5))
+	assert.True(t, ve.UpdatePointer("/routes/~1api~1v1", "frontend"))
+	assert.True(t, ve.UpdatePointer("/routes/*", "asterisk"))
+	assert.False(t, ve.UpdatePointer("/routes/missing", "x"))
+	assert.False(t, ve.UpdatePointer("", map[string]interface{}{}))
+	assert.False(t, ve.UpdatePointer("/routes/~2", "x"))
+
+	val, _ = ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 5, val)
+	assert.Equal(t, map[string]interface{}{
+		"/api/v1": "frontend",
+		"a__b":    "delimited",
+		"*":       "asterisk",
+		"til~de":  "tilde",
+	}, ve.AllSettings["routes"])
+
+	assert.True(t, ve.RemovePointer("/routes/a__b"))
+	assert.True(t, ve.RemovePointer("/nest/eggs/0"))
+	assert.False(t, ve.RemovePointer("/nest/eggs/0"))
+	assert.False(t, ve.RemovePointer(""))
+	assert.Equal(t, []interface{}{}, ve.AllSettings["nest"].(map[string]interface{})["eggs"])
+	_, found = ve.FindPointer("/routes/a__b")
+	assert.False(t, found)
+}
+
+func TestJSONPointer_CreateMissing(t *testing.T) {
+	ve, err := New(map[string]interface{}{}, WithCreateMissing(), WithArrayGrowth())
+	require.NoError(t, err)
+
+	assert.True(t, ve.UpdatePointer("/db/hosts/0/name", "primary"))
+	assert.Equal(t, map[string]interface{}{
+		"hosts": []interface{}{
+			map[string]interface{}{"name": "primary"},
+		},
+	}, ve.AllSettings["db"])
+}
+
+func TestPointer_ReservedSelectorKeys(t *testing.T) {
+	ve, err := New(map[string]interface{}{
+		"sort_where_x_eq_y": "literal",
+	}, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	// the deep-path key is read as a selector
+	_, found := ve.Find("sort_where_x_eq_y")
+	assert.False(t, found)
+
+	val, found := ve.FindPointer("/sort_where_x_eq_y")
+	assert.True(t, found)
+	assert.Equal(t, "literal", val)
+	assert.True(t, ve.UpdatePointer("/sort_where_x_eq_y", "updated"))
+	assert.Equal(t, "updated", ve.AllSettings["sort_where_x_eq_y"])
+}
+
+func TestPointer_StrictArrayIndexes(t *testing.T) {
+	ve, err := New(map[string]interface{}{
+		"a": []interface{}{
+			map[string]interface{}{"b": 9},
+			map[string]interface{}{"b": 10},
+		},
+	}, WithDelimiter(keyDelim), WithArrayGrowth(), WithCreateMissing())
+	require.NoError(t, err)
+
+	val, found := ve.FindPointer("/a/1/b")
+	assert.True(t, found)
+	assert.Equal(t, 10, val)
+
+	for _, pointer := range []string{"/a/01/b", "/a/+0/b", "/a/-0/b", "/a/01", "/a/+1"} {
+		_, found := ve.FindPointer(pointer)
+		assert.False(t, found, pointer)
+		assert.False(t, ve.UpdatePointer(pointer, 1), pointer)
+		assert.False(t, ve.RemovePointer(pointer), pointer)
+	}
+	assert.Len(t, ve.AllSettings["a"], 2)
+
+	// only a valid index creates an array, anything else is a member name
+	assert.True(t, ve.UpdatePointer("/c/01", 1))
+	assert.Equal(t, map[string]interface{}{"01": 1}, ve.AllSettings["c"])
+	assert.True(t, ve.UpdatePointer("/d/1", 1))
+	assert.Equal(t, []interface{}{nil, 1}, ve.AllSettings["d"])
+
+	// deep-path keys stay lenient
+	val, found = ve.Find("a__01__b")
+	assert.True(t, found)
+	assert.Equal(t, 10, val)
+}
@@ -0,0 +1,59 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ApplyMergePatch overlays patch onto the settings following RFC 7386 JSON
+// Merge Patch semantics: a null value deletes the key, objects are merged
+// recursively, and every other value (including arrays) replaces the
+// target. Incoming keys are normalized the same way New normalizes the
+// settings.
+func (ve *ViperEx) ApplyMergePatch(patch map[string]interface{}) {
+	mergePatch(ve.AllSettings, normalizeSettings(patch))
+}
+
+// ApplyMergePatchJSON decodes an RFC 7386 JSON Merge Patch document, e.g.
+// an appsettings.Production.json fragment, and applies it with
+// ApplyMergePatch. The document must be a JSON object. The settings are not
+// modified if it cannot be decoded.
+func (ve *ViperEx) ApplyMergePatchJSON(patch []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(patch, &doc); err != nil {
+		return fmt.Errorf("json merge patch: %w", err)
+	}
+	patchMap, ok := doc.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("json merge patch: document is a %T, not an object", doc)
+	}
+	ve.ApplyMergePatch(patchMap)
+	return nil
+}
+
+// mergePatch merges the normalized patch into target in place.
+func mergePatch(target map[string]interface{}, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		patchMap, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+		targetMap, ok := target[key].(map[string]interface{})
+		if !ok {
+			// a non-object target is replaced by the patch without its nulls
+			targetMap = make(map[string]interface{}, len(patchMap))
+		}
+		mergePatch(targetMap, patchMap)
+		target[key] = targetMap
+	}
+}
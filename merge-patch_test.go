@@ -0,0 +1,91 @@
+package viperEx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMergePatchJSON(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	err = myViperEx.ApplyMergePatchJSON([]byte(`{
+		"Name": "patched",
+		"MasterEgg": null,
+		"nest": {
+			"Name": "brick",
+			"Tags": ["X", "Y"],
+			"MasterEgg": {"Weight": 1, "SomeStrings": null}
+		},
+		"nestedMap": {
+			"eggs": {
+				"betty": null,
+				"Carl": {"Weight": 7, "Junk": null}
+			}
+		},
+		"name2": {"a": {"b": null, "c": 1}}
+	}`))
+	require.NoError(t, err)
+	t.Log(prettyJSON(myViperEx.AllSettings))
+
+	settings := Settings{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+	assert.Equal(t, "patched", settings.Name)
+	assert.Equal(t, "brick", settings.Nest.Name)
+	assert.Equal(t, []string{"X", "Y"}, settings.Nest.Tags)
+	assert.Equal(t, int32(1), settings.Nest.MasterEgg.Weight)
+	assert.Equal(t, "bob", settings.Nest.MasterEgg.Name)
+	assert.Empty(t, settings.Nest.MasterEgg.SomeStrings)
+	// untouched siblings survive
+	assert.Len(t, settings.Nest.Eggs, 2)
+
+	_, found := myViperEx.Find("masteregg")
+	assert.False(t, found)
+	_, found = myViperEx.Find("nestedmap__eggs__betty")
+	assert.False(t, found)
+	val, found := myViperEx.Find("nestedmap__eggs__carl")
+	assert.True(t, found)
+	assert.Equal(t, map[string]interface{}{"weight": float64(7)}, val)
+	val, found = myViperEx.Find("nestedmap__eggs__bob__weight")
+	assert.True(t, found)
+	assert.Equal(t, float64(12), val)
+	val, found = myViperEx.Find("name2")
+	assert.True(t, found)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"c": float64(1)}}, val)
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	ve, err := New(map[string]interface{}{
+		"name": "bob",
+		"tags": []interface{}{"a", "b"},
+		"db":   "scalar",
+	})
+	require.NoError(t, err)
+
+	ve.ApplyMergePatch(map[string]interface{}{
+		"Tags": []string{"c"},
+		"DB":   map[string]string{"Host": "localhost"},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"name": "bob",
+		"tags": []interface{}{"c"},
+		"db":   map[string]interface{}{"host": "localhost"},
+	}, ve.AllSettings)
+}
+
+func TestApplyMergePatchJSON_Invalid(t *testing.T) {
+	ve, err := New(map[string]interface{}{"name": "bob"})
+	require.NoError(t, err)
+
+	assert.Error(t, ve.ApplyMergePatchJSON([]byte(`[1, 2]`)))
+	assert.Error(t, ve.ApplyMergePatchJSON([]byte(`null`)))
+	assert.Error(t, ve.ApplyMergePatchJSON([]byte(`{"name": `)))
+	assert.Equal(t, map[string]interface{}{"name": "bob"}, ve.AllSettings)
+}
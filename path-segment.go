@@ -0,0 +1,214 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// wildcardSegment matches every map key or array index in a deep path.
+	wildcardSegment = "*"
+	// envSelectorWhere and envSelectorEquals spell out a selector in an
+	// env-safe way: eggs_WHERE_name_EQ_bob is the same as eggs[name=bob].
+	envSelectorWhere  = "_where_"
+	envSelectorEquals = "_eq_"
+)
+
+// pathSegment is one parsed step of a deep path.
+type pathSegment struct {
+	// key is the map key or array index, or the field name of a selector.
+	key string
+	// wildcard matches every map key or array index.
+	wildcard bool
+	// selector matches the first array element whose field key equals value.
+	selector bool
+	// value is the field value a selector compares against.
+	value string
+	// pointer marks an RFC 6901 JSON Pointer reference token, whose array
+	// indexes must not have leading zeros or signs.
+	pointer bool
+}
+
+// literalSegment returns a segment that addresses key verbatim.
+func literalSegment(key string) pathSegment {
+	return pathSegment{key: key}
+}
+
+// pointerSegment returns a segment for an RFC 6901 reference token.
+func pointerSegment(key string) pathSegment {
+	return pathSegment{key: key, pointer: true}
+}
+
+// index returns the array index seg addresses, or false if seg is not a
+// valid index. JSON Pointer tokens must be "0" or digits without a leading
+// zero, see isPointerIndex.
+func (seg pathSegment) index() (int, bool) {
+	if seg.pointer && !isPointerIndex(seg.key) {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(seg.key)
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+// isPointerIndex reports whether key is an RFC 6901 array index: "0" or
+// digits without a leading zero.
+func isPointerIndex(key string) bool {
+	if len(key) == 0 || (len(key) > 1 && key[0] == '0') {
+		return false
+	}
+	for _, c := range key {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the segment in deep-path key syntax.
+func (seg pathSegment) String() string {
+	switch {
+	case seg.wildcard:
+		return wildcardSegment
+	case seg.selector:
+		return fmt.Sprintf("[%s=%s]", seg.key, seg.value)
+	default:
+		return seg.key
+	}
+}
+
+// resolve returns the literal segment seg addresses within node. Selectors
+// resolve to the index of the first matching array element; literal
+// segments resolve to themselves. It returns false if a selector matches
+// nothing. Wildcards cannot be resolved.
+func (seg pathSegment) resolve(node interface{}) (pathSegment, bool) {
+	if seg.wildcard {
+		return seg, false
+	}
+	if !seg.selector {
+		return seg, true
+	}
+	array, ok := node.([]interface{})
+	if !ok {
+		return seg, false
+	}
+	for idx, element := range array {
+		item, ok := element.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field, ok := item[seg.key]
+		if !ok || field == nil {
+			continue
+		}
+		// keys are lowercased, so the comparison ignores case
+		if strings.EqualFold(fmt.Sprint(field), seg.value) {
+			return literalSegment(strconv.Itoa(idx)), true
+		}
+	}
+	return seg, false
+}
+
+// splitKey lowercases key and splits it into path segments using the
+// KeyDelimiter. It returns false if any segment is empty or malformed.
+func (ve *ViperEx) splitKey(key string) ([]pathSegment, bool) {
+	var path []pathSegment
+	for _, raw := range strings.Split(strings.ToLower(key), ve.KeyDelimiter) {
+		segments, ok := parseSegment(raw)
+		if !ok {
+			return nil, false
+		}
+		path = append(path, segments...)
+	}
+	return path, true
+}
+
+// parseSegment parses a single delimited piece of a deep-path key. A piece
+// carrying a selector, such as eggs[name=bob] or eggs_where_name_eq_bob,
+// yields the key segment followed by the selector segment.
+func parseSegment(raw string) ([]pathSegment, bool) {
+	if len(raw) == 0 {
+		return nil, false
+	}
+	if raw == wildcardSegment {
+		return []pathSegment{{wildcard: true}}, true
+	}
+	parts, found := cutSelector(raw)
+	if !found {
+		return []pathSegment{literalSegment(raw)}, true
+	}
+	if len(parts.field) == 0 {
+		return nil, false
+	}
+	selector := pathSegment{key: parts.field, selector: true, value: parts.value}
+	if len(parts.key) == 0 {
+		return []pathSegment{selector}, true
+	}
+	return []pathSegment{literalSegment(parts.key), selector}, true
+}
+
+// selectorParts are the pieces of a path segment carrying a selector.
+type selectorParts struct {
+	// key is the map key in front of the selector, if any.
+	key string
+	// field and value are the selector's field name and the value it must
+	// equal.
+	field string
+	value string
+}
+
+// cutSelector splits raw into the key in front of a selector and the
+// selector's field and value. found is false if raw has no selector.
+// A raw segment containing both _where_ and _eq_, or ending in a bracketed
+// field=value, is always read as a selector; keys spelled like that can
+// only be addressed with JSON Pointer.
+func cutSelector(raw string) (selectorParts, bool) {
+	var parts selectorParts
+	var found bool
+	if open := strings.Index(raw, "["); open >= 0 && strings.HasSuffix(raw, "]") {
+		parts.key = raw[:open]
+		parts.field, parts.value, found = strings.Cut(raw[open+1:len(raw)-1], "=")
+		return parts, found
+	}
+	if where := strings.Index(raw, envSelectorWhere); where >= 0 {
+		parts.key = raw[:where]
+		parts.field, parts.value, found = strings.Cut(raw[where+len(envSelectorWhere):], envSelectorEquals)
+		return parts, found
+	}
+	return parts, false
+}
+
+// joinPath renders path as a deep-path key using the KeyDelimiter.
+func (ve *ViperEx) joinPath(path []pathSegment) string {
+	keys := make([]string, len(path))
+	for i, seg := range path {
+		keys[i] = seg.String()
+	}
+	return strings.Join(keys, ve.KeyDelimiter)
+}
+
+// hasWildcard reports whether any segment of path is a wildcard.
+func hasWildcard(path []pathSegment) bool {
+	for _, seg := range path {
+		if seg.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// withSegment returns a copy of path with the segment at depth replaced.
+func withSegment(path []pathSegment, depth int, seg pathSegment) []pathSegment {
+	concrete := make([]pathSegment, len(path))
+	copy(concrete, path)
+	concrete[depth] = seg
+	return concrete
+}
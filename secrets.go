@@ -0,0 +1,159 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrSecretNotFound reports a secret reference that does not resolve to a
+// value.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretResolver resolves secret references of the scheme it is registered
+// for, e.g. secret://vault/db#password, to the secret value.
+type SecretResolver interface {
+	ResolveSecret(ref *url.URL) (string, error)
+}
+
+// SecretResolverFunc adapts a function to a SecretResolver.
+type SecretResolverFunc func(ref *url.URL) (string, error)
+
+// ResolveSecret calls f.
+func (f SecretResolverFunc) ResolveSecret(ref *url.URL) (string, error) {
+	return f(ref)
+}
+
+// FileSecretResolver resolves file references such as
+// file:///run/secrets/dbpw to the contents of the file without a single
+// trailing newline. References naming a host other than localhost, such as
+// file://run/secrets/dbpw with only two slashes, are rejected rather than
+// read from a different path. Register it with WithSecretResolver("file",
+// FileSecretResolver{}).
+type FileSecretResolver struct{}
+
+// ResolveSecret reads the file ref points to.
+func (FileSecretResolver) ResolveSecret(ref *url.URL) (string, error) {
+	if len(ref.Host) > 0 && ref.Host != "localhost" {
+		return "", fmt.Errorf("file reference with host %q: use file:///path for an absolute path", ref.Host)
+	}
+	if len(ref.Path) == 0 {
+		return "", fmt.Errorf("%w: no file path", ErrSecretNotFound)
+	}
+	return readValueFile(ref.Path)
+}
+
+// EnvSecretResolver resolves references such as env:DB_PASSWORD or
+// env://DB_PASSWORD to the value of the environment variable. Register it
+// with WithSecretResolver("env", EnvSecretResolver{}).
+type EnvSecretResolver struct {
+	// Source supplies the variables. When nil the process environment is
+	// used.
+	Source EnvSource
+}
+
+// ResolveSecret looks up the variable ref names.
+func (r EnvSecretResolver) ResolveSecret(ref *url.URL) (string, error) {
+	name := ref.Opaque
+	if len(name) == 0 {
+		name = ref.Host + ref.Path
+	}
+	if r.Source == nil {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("%w: env %q", ErrSecretNotFound, name)
+	}
+	for _, element := range r.Source.Environ() {
+		if key, value, found := strings.Cut(element, "="); found && key == name {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: env %q", ErrSecretNotFound, name)
+}
+
+// ResolveSecrets replaces every string value that is a URL with a
+// registered scheme, such as secret://vault/db#password or
+// file:///run/secrets/dbpw, by the value its SecretResolver returns. Other
+// strings, including URLs of unregistered schemes, are left alone. The
+// whole tree is walked, including arrays. Resolved values are marked as
+// sensitive, see RedactedSettings. Resolution is atomic: if any
+// reference fails, the settings are left untouched and the returned error
+// names every failing path. On success AllSettings is replaced by the
+// resolved copy.
+func (ve *ViperEx) ResolveSecrets() error {
+	var resolved sensitiveMarks
+	err := ve.atomically(func() error {
+		return errors.Join(ve.replaceStrings(func(path []pathSegment, value string) (interface{}, error) {
+			ref, resolver := ve.secretReference(value)
+			if resolver == nil {
+				return value, nil
+			}
+			secret, err := resolver.ResolveSecret(ref)
+			if err != nil {
+				return nil, fmt.Errorf("resolve secret %q (%s): %w", ve.joinPath(path), ref.Scheme, err)
+			}
+			resolved = append(resolved, sensitiveMark{path: path, value: secret})
+			return secret, nil
+		})...)
+	})
+	if err != nil {
+		return err
+	}
+	for _, mark := range resolved {
+		ve.markSensitive(mark.path, mark.value)
+	}
+	return nil
+}
+
+// secretReference parses value as a secret reference. It returns a nil
+// resolver if value is not a URL of a registered scheme.
+func (ve *ViperEx) secretReference(value string) (*url.URL, SecretResolver) {
+	if len(ve.SecretResolvers) == 0 || !strings.Contains(value, ":") {
+		return nil, nil
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		return nil, nil
+	}
+	return ref, ve.SecretResolvers[ref.Scheme]
+}
+
+// replaceStrings calls fn for every string value in the settings and
+// stores the value fn returns in its place. The values for which fn fails
+// are kept and the errors are returned.
+func (ve *ViperEx) replaceStrings(fn func(path []pathSegment, value string) (interface{}, error)) []error {
+	var errs []error
+	var walk func(node interface{}, path []pathSegment) interface{}
+	walk = func(node interface{}, path []pathSegment) interface{} {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			// sorted keys keep the errors in a stable order
+			for _, seg := range childKeys(container) {
+				container[seg.key] = walk(container[seg.key], append(path[:len(path):len(path)], seg))
+			}
+		case []interface{}:
+			for idx, child := range container {
+				container[idx] = walk(child, append(path[:len(path):len(path)], literalSegment(strconv.Itoa(idx))))
+			}
+		case string:
+			replaced, err := fn(path, container)
+			if err != nil {
+				errs = append(errs, err)
+				return node
+			}
+			return replaced
+		}
+		return node
+	}
+	walk(ve.AllSettings, nil)
+	return errs
+}
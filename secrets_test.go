@@ -0,0 +1,131 @@
+package viperEx
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault resolves secret://vault/<path>#<field> from a map.
+var fakeVault = SecretResolverFunc(func(ref *url.URL) (string, error) {
+	secrets := map[string]string{
+		"vault/db#password": "s3cret",
+		"vault/api#key":     "k3y",
+	}
+	if value, ok := secrets[ref.Host+ref.Path+"#"+ref.Fragment]; ok {
+		return value, nil
+	}
+	return "", ErrSecretNotFound
+})
+
+func TestResolveSecrets(t *testing.T) {
+	t.Parallel()
+	secretFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(secretFile, []byte("t0ken\n"), 0o600))
+
+	ve, err := New(map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": "secret://vault/db#password",
+			"host":     "https://db.internal",
+		},
+		"tokens": []interface{}{
+			"file://" + secretFile,
+			map[string]interface{}{"key": "secret://vault/api#key"},
+		},
+		"user":  "env:DB_USER",
+		"count": 3,
+	}, WithDelimiter(keyDelim),
+		WithSecretResolver("secret", fakeVault),
+		WithSecretResolver("FILE", FileSecretResolver{}),
+		WithSecretResolver("env", EnvSecretResolver{Source: EnvMap{"DB_USER": "admin"}}))
+	require.NoError(t, err)
+
+	require.NoError(t, ve.ResolveSecrets())
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, "s3cret", val)
+	val, _ = ve.Find("db__host")
+	assert.Equal(t, "https://db.internal", val)
+	val, _ = ve.Find("tokens__0")
+	assert.Equal(t, "t0ken", val)
+	val, _ = ve.Find("tokens__1__key")
+	assert.Equal(t, "k3y", val)
+	assert.Equal(t, "admin", ve.AllSettings["user"])
+	assert.Equal(t, 3, ve.AllSettings["count"])
+	assert.Equal(t, []string{"db__password", "tokens__0", "tokens__1__key", "user"}, ve.SensitivePaths())
+	assert.Equal(t, RedactedValue, ve.RedactedSettings()["user"])
+}
+
+func TestResolveSecrets_Errors(t *testing.T) {
+	t.Parallel()
+	ve, err := New(map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": "secret://vault/db#password",
+			"user":     "secret://vault/db#user",
+		},
+		"tokens": []interface{}{"file://" + filepath.Join(t.TempDir(), "missing")},
+		"home":   "env://VIPEREX_TEST_NOT_SET",
+	}, WithDelimiter(keyDelim),
+		WithSecretResolver("secret", fakeVault),
+		WithSecretResolver("file", FileSecretResolver{}),
+		WithSecretResolver("env", EnvSecretResolver{}))
+	require.NoError(t, err)
+
+	err = ve.ResolveSecrets()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Contains(t, err.Error(), `resolve secret "db__user" (secret)`)
+	assert.Contains(t, err.Error(), `resolve secret "tokens__0" (file)`)
+	assert.Contains(t, err.Error(), `resolve secret "home" (env)`)
+	assert.NotContains(t, err.Error(), "db__password")
+
+	// nothing was resolved
+	val, _ := ve.Find("db__password")
+	assert.Equal(t, "secret://vault/db#password", val)
+
+	_, err = New(map[string]interface{}{}, WithSecretResolver("", fakeVault))
+	assert.Error(t, err)
+}
+
+func TestFileSecretResolver(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cret\n"), 0o600))
+
+	for _, raw := range []string{"file://" + secretFile, "file://localhost" + secretFile} {
+		ref, err := url.Parse(raw)
+		require.NoError(t, err)
+		value, err := FileSecretResolver{}.ResolveSecret(ref)
+		require.NoError(t, err, raw)
+		assert.Equal(t, "s3cret", value, raw)
+	}
+
+	// with two slashes the first path element becomes the host
+	ref, err := url.Parse("file:/" + secretFile)
+	require.NoError(t, err)
+	require.NotEmpty(t, ref.Host)
+	_, err = FileSecretResolver{}.ResolveSecret(ref)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ref.Host)
+	assert.NotErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestEnvSecretResolver(t *testing.T) {
+	t.Setenv("VIPEREX_TEST_SECRET", "from env")
+	for _, raw := range []string{"env:VIPEREX_TEST_SECRET", "env://VIPEREX_TEST_SECRET"} {
+		ref, err := url.Parse(raw)
+		require.NoError(t, err)
+		value, err := EnvSecretResolver{}.ResolveSecret(ref)
+		require.NoError(t, err)
+		assert.Equal(t, "from env", value)
+	}
+	ref, _ := url.Parse("env:VIPEREX_TEST_NOT_SET")
+	_, err := EnvSecretResolver{}.ResolveSecret(ref)
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
@@ -0,0 +1,203 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import "strconv"
+
+// sensitiveMark records a sensitive value and the concrete path holding it.
+type sensitiveMark struct {
+	path  []pathSegment
+	value string
+}
+
+// sensitiveMarks are kept in step with the settings as values are removed,
+// inserted, moved and copied. A mark only counts while its path still holds
+// its value, see holding. The methods never modify the receiver, so a copy
+// of the slice header is enough to roll changes back.
+type sensitiveMarks []sensitiveMark
+
+// markSensitive records that the concrete path holds the sensitive value.
+func (ve *ViperEx) markSensitive(path []pathSegment, value string) {
+	ve.sensitive = append(ve.sensitive.without(path), sensitiveMark{path: path, value: value})
+}
+
+// holding returns the marks whose path still holds their value in root.
+func (m sensitiveMarks) holding(root interface{}) sensitiveMarks {
+	var held sensitiveMarks
+	for _, mark := range m {
+		if value, ok := lookupPath(root, mark.path); ok && value == mark.value {
+			held = append(held, mark)
+		}
+	}
+	return held
+}
+
+// holds reports whether the concrete path holds a sensitive value in root.
+func (m sensitiveMarks) holds(root interface{}, path []pathSegment) bool {
+	for _, mark := range m.holding(root) {
+		if len(mark.path) == len(path) && hasPathPrefix(mark.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the marks that are not at or below path.
+func (m sensitiveMarks) without(path []pathSegment) sensitiveMarks {
+	kept := make(sensitiveMarks, 0, len(m))
+	for _, mark := range m {
+		if !hasPathPrefix(mark.path, path) {
+			kept = append(kept, mark)
+		}
+	}
+	return kept
+}
+
+// rebased returns copies of the marks at or below from, moved to the same
+// place below to.
+func (m sensitiveMarks) rebased(from []pathSegment, to []pathSegment) sensitiveMarks {
+	var rebased sensitiveMarks
+	for _, mark := range m {
+		if hasPathPrefix(mark.path, from) {
+			path := append(append([]pathSegment{}, to...), mark.path[len(from):]...)
+			rebased = append(rebased, sensitiveMark{path: path, value: mark.value})
+		}
+	}
+	return rebased
+}
+
+// shifted returns the marks with the indexes of the elements of the array
+// at arrayPath moved by delta, starting with the element at start.
+func (m sensitiveMarks) shifted(arrayPath []pathSegment, start int, delta int) sensitiveMarks {
+	shifted := make(sensitiveMarks, 0, len(m))
+	for _, mark := range m {
+		if len(mark.path) > len(arrayPath) && hasPathPrefix(mark.path, arrayPath) {
+			if idx, err := strconv.Atoi(mark.path[len(arrayPath)].key); err == nil && idx >= start {
+				path := withSegment(mark.path, len(arrayPath), literalSegment(strconv.Itoa(idx+delta)))
+				mark = sensitiveMark{path: path, value: mark.value}
+			}
+		}
+		shifted = append(shifted, mark)
+	}
+	return shifted
+}
+
+// removed returns the marks after the value at the concrete path has been
+// removed from root. The elements after a removed array element move down.
+func (m sensitiveMarks) removed(root interface{}, path []pathSegment) sensitiveMarks {
+	m = m.without(path)
+	if len(path) == 0 {
+		return m
+	}
+	parent, _ := lookupPath(root, path[:len(path)-1])
+	if _, ok := parent.([]interface{}); ok {
+		if idx, err := strconv.Atoi(path[len(path)-1].key); err == nil {
+			m = m.shifted(path[:len(path)-1], idx+1, -1)
+		}
+	}
+	return m
+}
+
+// added returns the marks after a value is added at the JSON Patch path in
+// root, together with the concrete path of the new value. An array element
+// is inserted and the elements from its index on move up; anything else at
+// path is replaced.
+func (m sensitiveMarks) added(root interface{}, path []pathSegment) (sensitiveMarks, []pathSegment) {
+	if len(path) == 0 {
+		return nil, path
+	}
+	parent, _ := lookupPath(root, path[:len(path)-1])
+	array, ok := parent.([]interface{})
+	if !ok {
+		return m.without(path), path
+	}
+	if path[len(path)-1].key == "-" {
+		return m, withSegment(path, len(path)-1, literalSegment(strconv.Itoa(len(array))))
+	}
+	idx, err := strconv.Atoi(path[len(path)-1].key)
+	if err != nil {
+		return m, path
+	}
+	return m.shifted(path[:len(path)-1], idx, 1), path
+}
+
+// patched returns the marks after operation has been applied to doc. It is
+// only called for operations that succeed.
+func (m sensitiveMarks) patched(doc interface{}, operation patchOperation) sensitiveMarks {
+	if operation.Path == nil {
+		return m
+	}
+	path, err := parsePointer(*operation.Path)
+	if err != nil {
+		return m
+	}
+	switch operation.Op {
+	case "add":
+		m, _ = m.added(doc, path)
+	case "replace":
+		m = m.without(path)
+	case "remove":
+		m = m.removed(doc, path)
+	case "move", "copy":
+		if operation.From == nil {
+			return m
+		}
+		from, err := parsePointer(*operation.From)
+		if err != nil {
+			return m
+		}
+		source := m
+		if operation.Op == "move" {
+			m = m.removed(doc, from)
+			// the target path refers to the document without the value
+			doc, _, _ = patchRemove(normalizeValue(doc), from)
+		}
+		m, path = m.added(doc, path)
+		m = append(m, source.rebased(from, path)...)
+	}
+	return m
+}
+
+// concretePath resolves the selectors of path in root and spells its array
+// indexes as the paths of marks do. It returns false if path does not
+// exist.
+func concretePath(root interface{}, path []pathSegment) ([]pathSegment, bool) {
+	concrete := make([]pathSegment, len(path))
+	node := root
+	for i, seg := range path {
+		resolved, ok := seg.resolve(node)
+		if !ok {
+			return nil, false
+		}
+		if _, isArray := node.([]interface{}); isArray {
+			idx, ok := resolved.index()
+			if !ok {
+				return nil, false
+			}
+			resolved = literalSegment(strconv.Itoa(idx))
+		}
+		child, ok := stepInto(node, resolved)
+		if !ok {
+			return nil, false
+		}
+		concrete[i] = literalSegment(resolved.key)
+		node = child
+	}
+	return concrete, true
+}
+
+// hasPathPrefix reports whether path starts with prefix.
+func hasPathPrefix(path []pathSegment, prefix []pathSegment) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, seg := range prefix {
+		if seg.key != path[i].key {
+			return false
+		}
+	}
+	return true
+}
@@ -2,11 +2,9 @@ package viperEx
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"testing"
 
-	"github.com/jinzhu/copier"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 )
@@ -14,21 +12,25 @@ import (
 var (
 	configDefaultJSON = []byte(`
 {
-	"nest": {}
+	"templates": {
+		"egg": {
+			"name": "in-environment",
+			"weight": 0,
+			"somestrings": [
+				"in-environment","in-environment", "in-environment"
+			],
+			"somevalues": [{
+				"value": "in-environment"
+			}, {
+				"value": "in-environment"
+			}]
+		}
+	},
+	"nest": {
+		"eggs": []
+	}
 }
 `)
-	stemEgg = `{
-	"name": "in-environment",
-	"weight": 0,
-	"somestrings": [
-		"in-environment","in-environment", "in-environment"
-	],
-	"somevalues": [{
-		"value": "in-environment"
-	}, {
-		"value": "in-environment"
-	}]
-}`
 )
 
 type (
@@ -41,33 +43,20 @@ type (
 )
 
 func TestViperExEnvUpdate_dynamic_nest(t *testing.T) {
-	const numEggs = 3
-	var egg = &Egg{}
-	err := json.Unmarshal([]byte(stemEgg), egg)
-	require.NoError(t, err)
-	var dynamicConfig = &DynamicConfig{}
-	err = json.Unmarshal(configDefaultJSON, dynamicConfig)
-	require.NoError(t, err)
-	for i := 0; i < numEggs; i++ {
-		newEgg := &Egg{}
-		copier.Copy(&newEgg, egg)
-		dynamicConfig.Nest.Eggs = append(dynamicConfig.Nest.Eggs, newEgg)
-	}
-	finalJSON, err := json.Marshal(dynamicConfig)
-	require.NoError(t, err)
-
 	myViper := viper.NewWithOptions(viper.KeyDelimiter(keyDelim))
 	myViper.SetConfigType("json")
 	myViper.AutomaticEnv()
-	myViper.ReadConfig(bytes.NewBuffer(finalJSON))
+	err := myViper.ReadConfig(bytes.NewBuffer(configDefaultJSON))
+	require.NoError(t, err)
 
 	allSettings := myViper.AllSettings()
 	t.Log(prettyJSON(allSettings))
 
-	myViperEx, err := New(allSettings, func(ve *ViperEx) error {
-		ve.KeyDelimiter = keyDelim
-		return nil
-	})
+	myViperEx, err := New(allSettings,
+		WithDelimiter(keyDelim),
+		WithArrayGrowth(),
+		WithArrayTemplate("nest__eggs", "templates__egg"))
+	require.NoError(t, err)
 
 	envs := map[string]string{
 		"nest__eggs__0__name":                 "name0",
@@ -102,8 +91,9 @@ func TestViperExEnvUpdate_dynamic_nest(t *testing.T) {
 	settings := &DynamicConfig{}
 	err = myViperEx.Unmarshal(&settings)
 	require.NoError(t, err)
-	t.Log(prettyJSON(allSettings))
+	t.Log(prettyJSON(myViperEx.AllSettings))
 
+	require.Len(t, settings.Nest.Eggs, 3)
 	for idx, egg := range settings.Nest.Eggs {
 		require.Equal(t, fmt.Sprintf("name%d", idx), egg.Name, "egg name")
 		require.Equal(t, int32(idx+1), egg.Weight, "egg weight")
@@ -115,3 +105,149 @@ func TestViperExEnvUpdate_dynamic_nest(t *testing.T) {
 		}
 	}
 }
+
+func TestViperExEnvUpdate_grow_arrays(t *testing.T) {
+	myViper := viper.NewWithOptions(viper.KeyDelimiter(keyDelim))
+	myViper.SetConfigType("json")
+	err := myViper.ReadConfig(bytes.NewBufferString(`{"nest": {"eggs": []}}`))
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim), WithArrayGrowth(), WithCreateMissing())
+	require.NoError(t, err)
+
+	envs := map[string]string{
+		"nest__eggs__0__name":           "name0",
+		"nest__eggs__0__somestrings__0": "name0_somestring0",
+		"nest__eggs__2__name":           "name2",
+		"nest__eggs__2__weight":         "3",
+		"nest__eggs__2__somestrings__1": "name2_somestring1",
+	}
+	for k, v := range envs {
+		t.Setenv(k, v)
+	}
+	myViperEx.UpdateFromEnv()
+	t.Log(prettyJSON(myViperEx.AllSettings))
+
+	settings := &DynamicConfig{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+
+	require.Len(t, settings.Nest.Eggs, 3)
+	require.Equal(t, "name0", settings.Nest.Eggs[0].Name)
+	require.Equal(t, []string{"name0_somestring0"}, settings.Nest.Eggs[0].SomeStrings)
+	require.Nil(t, settings.Nest.Eggs[1])
+	require.Equal(t, "name2", settings.Nest.Eggs[2].Name)
+	require.Equal(t, int32(3), settings.Nest.Eggs[2].Weight)
+	require.Equal(t, []string{"", "name2_somestring1"}, settings.Nest.Eggs[2].SomeStrings)
+}
+
+func TestUpdateDeepPath_GrowArrays(t *testing.T) {
+	settings := map[string]interface{}{
+		"name": "bob",
+		"tags": []interface{}{"a"},
+	}
+
+	strict, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+	require.False(t, strict.UpdateDeepPath("tags__1", "b"))
+
+	ve, err := New(settings, WithDelimiter(keyDelim), WithArrayGrowth())
+	require.NoError(t, err)
+
+	// index equal to the length appends
+	require.True(t, ve.UpdateDeepPath("tags__1", "b"))
+	// index beyond the length fills the gap with nil
+	require.True(t, ve.UpdateDeepPath("tags__3", "d"))
+	require.Equal(t, []interface{}{"a", "b", nil, "d"}, ve.AllSettings["tags"])
+
+	// negative and non-numeric indexes are rejected
+	require.False(t, ve.UpdateDeepPath("tags__-1", "x"))
+	require.False(t, ve.UpdateDeepPath("tags__x", "x"))
+
+	// a failed update does not leave a grown array behind
+	require.False(t, ve.UpdateDeepPath("tags__9__name__first", "x"))
+	require.False(t, ve.UpdateDeepPath("tags__0__name", "x"))
+	require.Len(t, ve.AllSettings["tags"], 4)
+
+	// missing keys and nil elements are not filled without WithCreateMissing
+	require.False(t, ve.UpdateDeepPath("servers__0__host", "x"))
+	require.False(t, ve.UpdateDeepPath("tags__2__host", "x"))
+
+	// with WithCreateMissing a missing node followed by an index is an array
+	both, err := New(settings, WithDelimiter(keyDelim), WithArrayGrowth(), WithCreateMissing())
+	require.NoError(t, err)
+	require.True(t, both.UpdateDeepPath("servers__1__host", "beta"))
+	require.Equal(t, []interface{}{nil, map[string]interface{}{"host": "beta"}}, both.AllSettings["servers"])
+	require.True(t, both.UpdateDeepPath("servers__0__ports__1", 443))
+	require.Equal(t, map[string]interface{}{"ports": []interface{}{nil, 443}}, both.AllSettings["servers"].([]interface{})[0])
+}
+
+func TestViperExEnvUpdate_template_defaults(t *testing.T) {
+	myViper := viper.NewWithOptions(viper.KeyDelimiter(keyDelim))
+	myViper.SetConfigType("json")
+	err := myViper.ReadConfig(bytes.NewBuffer(configDefaultJSON))
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(),
+		WithDelimiter(keyDelim),
+		WithArrayGrowth(),
+		WithArrayTemplate("nest__eggs", "templates__egg"))
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs__1__name", "name1")
+	t.Setenv("nest__eggs__1__somestrings__2", "name1_somestring2")
+	myViperEx.UpdateFromEnv()
+
+	settings := &DynamicConfig{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+
+	require.Len(t, settings.Nest.Eggs, 2)
+	// the gap is not filled from the template
+	require.Nil(t, settings.Nest.Eggs[0])
+	egg := settings.Nest.Eggs[1]
+	require.Equal(t, "name1", egg.Name)
+	require.Equal(t, int32(0), egg.Weight)
+	require.Equal(t, []string{"in-environment", "in-environment", "name1_somestring2"}, egg.SomeStrings)
+	require.Len(t, egg.SomeValues, 2)
+	require.Equal(t, "in-environment", egg.SomeValues[1].Value)
+
+	// the template itself is untouched
+	name, found := myViperEx.Find("templates__egg__name")
+	require.True(t, found)
+	require.Equal(t, "in-environment", name)
+	strs, found := myViperEx.Find("templates__egg__somestrings")
+	require.True(t, found)
+	require.Equal(t, []interface{}{"in-environment", "in-environment", "in-environment"}, strs)
+}
+
+func TestUpdateDeepPath_FirstElementTemplate(t *testing.T) {
+	settings := map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"host": "alpha", "port": 80},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithArrayGrowth(), WithFirstElementTemplate())
+	require.NoError(t, err)
+
+	require.True(t, ve.UpdateDeepPath("servers__1__host", "beta"))
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"host": "alpha", "port": 80},
+		map[string]interface{}{"host": "beta", "port": 80},
+	}, ve.AllSettings["servers"])
+
+	// the clone is a deep copy
+	require.True(t, ve.UpdateDeepPath("servers__1__port", 443))
+	port, found := ve.Find("servers__0__port")
+	require.True(t, found)
+	require.Equal(t, 80, port)
+
+	// keys missing from the template still need WithCreateMissing
+	require.False(t, ve.UpdateDeepPath("servers__2__tls", true))
+	require.Len(t, ve.AllSettings["servers"], 2)
+
+	// without a template the element cannot be shaped
+	plain, err := New(settings, WithDelimiter(keyDelim), WithArrayGrowth())
+	require.NoError(t, err)
+	require.False(t, plain.UpdateDeepPath("servers__1__host", "beta"))
+}
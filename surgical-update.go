@@ -8,7 +8,10 @@
 package viperEx
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,7 +23,9 @@ const defaultKeyDelimiter = "."
 
 // normalizeValue applies type normalization to a single value:
 // lowercases map keys, converts []string→[]interface{}, and
-// converts map[string]string→map[string]interface{}.
+// converts map[string]string→map[string]interface{}. Other typed slices
+// (e.g. [][]string) and string-keyed maps are converted via reflection so
+// that every nesting level can be traversed by deep-path keys.
 func normalizeValue(v interface{}) interface{} {
 	switch val := v.(type) {
 	case map[string]interface{}:
@@ -43,6 +48,36 @@ func normalizeValue(v interface{}) interface{} {
 			newSlice[i] = item
 		}
 		return newSlice
+	default:
+		return normalizeReflectValue(v)
+	}
+}
+
+// normalizeReflectValue converts typed slices and string-keyed maps that
+// normalizeValue does not handle directly. Byte slices and all other values
+// are returned unchanged.
+func normalizeReflectValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		newSlice := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			newSlice[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return newSlice
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		newMap := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			newMap[strings.ToLower(iter.Key().String())] = normalizeValue(iter.Value().Interface())
+		}
+		return newMap
 	default:
 		return v
 	}
@@ -73,6 +108,188 @@ func WithEnvPrefix(envPrefix string) func(*ViperEx) error {
 	}
 }
 
+// WithEnvPrefixes sets several environment variable prefixes, in increasing
+// order of precedence: when the same key arrives with more than one prefix,
+// the value carrying the later prefix wins. For example, with
+// WithEnvPrefixes("PLATFORM", "ORDERS"), ORDERS_db__host beats
+// PLATFORM_db__host. Like WithEnvPrefix, each prefix is separated from keys
+// by an underscore. If a variable carries more than one prefix, e.g. APP_DB_
+// and APP_, the longest prefix applies. EnvPrefixes take the place of
+// EnvPrefix.
+func WithEnvPrefixes(envPrefixes ...string) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.EnvPrefixes = nil
+		for _, envPrefix := range envPrefixes {
+			envPrefix = strings.TrimRight(envPrefix, "_")
+			if len(envPrefix) == 0 {
+				return errors.New("env prefix must not be empty")
+			}
+			v.EnvPrefixes = append(v.EnvPrefixes, envPrefix+"_")
+		}
+		return nil
+	}
+}
+
+// WithEnvFileSuffix makes UpdateFromEnv treat variables whose key ends with
+// suffix as a reference to a file holding the value, following the
+// Docker/Kubernetes secrets convention: with WithEnvFileSuffix("_FILE"),
+// APP_db__password_FILE=/run/secrets/dbpw sets db__password to the contents
+// of /run/secrets/dbpw without its trailing newline.
+func WithEnvFileSuffix(suffix string) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.EnvFileSuffix = suffix
+		return nil
+	}
+}
+
+// WithDotEnvFile adds a dotenv file, see ParseDotEnv, whose variables
+// UpdateFromEnv applies together with the environment, following the same
+// prefix and deep-path rules. When several files are added, later files win
+// over earlier ones. The environment wins over all dotenv files unless
+// WithDotEnvOverride is set. The file is read by UpdateFromEnv, which fails
+// if it does not exist.
+func WithDotEnvFile(path string) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.DotEnvFiles = append(v.DotEnvFiles, path)
+		return nil
+	}
+}
+
+// WithDotEnvOverride makes the variables of dotenv files win over the
+// environment.
+func WithDotEnvOverride() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.DotEnvOverridesEnv = true
+		return nil
+	}
+}
+
+// WithSecretResolver registers resolver for secret references of scheme,
+// see ResolveSecrets. No resolvers are registered by default.
+func WithSecretResolver(scheme string, resolver SecretResolver) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		if len(scheme) == 0 || resolver == nil {
+			return errors.New("secret resolver needs a scheme and a resolver")
+		}
+		if v.SecretResolvers == nil {
+			v.SecretResolvers = make(map[string]SecretResolver)
+		}
+		v.SecretResolvers[strings.ToLower(scheme)] = resolver
+		return nil
+	}
+}
+
+// WithEncryptionKey sets the 32-byte AES-256 key DecryptValues uses.
+func WithEncryptionKey(key []byte) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		if len(key) != 32 {
+			return fmt.Errorf("encryption key must be 32 bytes, not %d", len(key))
+		}
+		v.EncryptionKey = key
+		return nil
+	}
+}
+
+// WithEncryptionKeyEnv makes DecryptValues read the base64-encoded key from
+// the named environment variable instead of DefaultEncryptionKeyEnv.
+func WithEncryptionKeyEnv(name string) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.EncryptionKeyEnv = name
+		return nil
+	}
+}
+
+// WithCreateMissing makes UpdateDeepPath (and therefore UpdateFromEnv)
+// create missing intermediate maps and the final key instead of ignoring
+// paths that do not exist yet. Existing scalar values are never replaced
+// by a map.
+func WithCreateMissing() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.CreateMissing = true
+		return nil
+	}
+}
+
+// WithArrayGrowth lets UpdateDeepPath (and therefore UpdateFromEnv) extend
+// an array when the index is at or beyond its end. Gaps are filled with nil.
+// Combined with WithCreateMissing, nil elements in the middle of a path
+// become new maps, so a list of items can be defined entirely from the
+// environment.
+func WithArrayGrowth() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.GrowArrays = true
+		return nil
+	}
+}
+
+// WithEnvTypeCoercion makes UpdateFromEnv convert each env value to the
+// type of the value it replaces (bool, integer, float, or a comma-separated
+// array) instead of always storing a string. Values for paths that do not
+// exist yet are stored as strings.
+func WithEnvTypeCoercion() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.CoerceEnvTypes = true
+		return nil
+	}
+}
+
+// WithEnvJSONValues makes UpdateFromEnv decode env values that start with
+// "{" or "[" as JSON, so that one variable can replace a whole subtree such
+// as nest__eggs. Decoded values are normalized like the rest of the
+// settings. Values that are not valid JSON are not applied and are reported
+// in the error returned by UpdateFromEnv.
+func WithEnvJSONValues() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.EnvJSONValues = true
+		return nil
+	}
+}
+
+// WithStrictEnv makes UpdateFromEnv fail when a variable carrying the
+// configured env prefix does not resolve to a path, so that misconfigured
+// deployments fail fast. In strict mode any error leaves the settings
+// untouched. It has no effect without WithEnvPrefix or WithEnvPrefixes.
+func WithStrictEnv() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.StrictEnv = true
+		return nil
+	}
+}
+
+// WithEnvSource makes UpdateFromEnv read variables from source instead of
+// the process environment, e.g. WithEnvSource(EnvMap{"nest__name": "x"}).
+func WithEnvSource(source EnvSource) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.EnvSource = source
+		return nil
+	}
+}
+
+// WithFirstElementTemplate makes new array elements created by a deep-path
+// update start as a deep copy of the first element of the same array, so
+// that untouched fields keep its values. The copy reflects the first element
+// at the time of the update, including earlier overrides.
+func WithFirstElementTemplate() func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		v.CloneFirstElement = true
+		return nil
+	}
+}
+
+// WithArrayTemplate makes new elements of the array at arrayKey start as a
+// deep copy of the value at templateKey. Both keys are deep-path keys using
+// the KeyDelimiter in effect when the update runs.
+// For example, WithArrayTemplate("nest__eggs", "templates__egg").
+func WithArrayTemplate(arrayKey string, templateKey string) func(*ViperEx) error {
+	return func(v *ViperEx) error {
+		if v.ArrayTemplates == nil {
+			v.ArrayTemplates = make(map[string]string)
+		}
+		v.ArrayTemplates[strings.ToLower(arrayKey)] = templateKey
+		return nil
+	}
+}
+
 // WithDelimiter sets the key path delimiter used to separate path segments.
 // The default delimiter is ".".
 func WithDelimiter(delimiter string) func(*ViperEx) error {
@@ -104,172 +321,673 @@ func New(allsettings map[string]interface{}, options ...func(*ViperEx) error) (*
 type ViperEx struct {
 	// KeyDelimiter separates path segments in deep-path keys (default ".").
 	KeyDelimiter string
-	// AllSettings holds the normalized configuration map.
+	// AllSettings holds the normalized configuration map. Methods that
+	// apply their changes atomically, such as ApplyJSONPatch, update a copy
+	// and replace the map with it on success, so maps obtained earlier from
+	// AllSettings or Find no longer reflect the settings after such a call.
 	AllSettings map[string]interface{}
 	// EnvPrefix, when set, filters environment variables to only those
 	// starting with this prefix. Set via WithEnvPrefix.
 	EnvPrefix string
+	// EnvPrefixes, when set, replaces EnvPrefix with several prefixes in
+	// increasing order of precedence. Set via WithEnvPrefixes.
+	EnvPrefixes []string
+	// EnvFileSuffix, when set, marks env vars whose value is the path of a
+	// file holding the actual value. Set via WithEnvFileSuffix.
+	EnvFileSuffix string
+	// CreateMissing, when true, makes UpdateDeepPath create missing map
+	// nodes along the path. Set via WithCreateMissing.
+	CreateMissing bool
+	// GrowArrays, when true, makes UpdateDeepPath extend arrays whose
+	// index is out of range. Set via WithArrayGrowth.
+	GrowArrays bool
+	// CloneFirstElement, when true, makes new array elements start as a
+	// copy of the first element. Set via WithFirstElementTemplate.
+	CloneFirstElement bool
+	// ArrayTemplates maps lowercased array keys to the key of the template
+	// new elements are copied from. Set via WithArrayTemplate.
+	ArrayTemplates map[string]string
+	// CoerceEnvTypes, when true, makes UpdateFromEnv convert env values to
+	// the type of the existing value. Set via WithEnvTypeCoercion.
+	CoerceEnvTypes bool
+	// EnvJSONValues, when true, makes UpdateFromEnv decode JSON object and
+	// array values. Set via WithEnvJSONValues.
+	EnvJSONValues bool
+	// StrictEnv, when true, makes UpdateFromEnv fail on prefixed env vars
+	// that do not resolve to a path. Set via WithStrictEnv.
+	StrictEnv bool
+	// EnvSource supplies the variables UpdateFromEnv reads. When nil the
+	// process environment is used. Set via WithEnvSource.
+	EnvSource EnvSource
+	// DotEnvFiles lists dotenv files UpdateFromEnv reads in addition to the
+	// environment, in increasing order of precedence. Set via
+	// WithDotEnvFile.
+	DotEnvFiles []string
+	// DotEnvOverridesEnv, when true, makes the DotEnvFiles win over the
+	// environment. Set via WithDotEnvOverride.
+	DotEnvOverridesEnv bool
+	// SecretResolvers maps lowercased URL schemes to the resolvers
+	// ResolveSecrets uses for them. Set via WithSecretResolver.
+	SecretResolvers map[string]SecretResolver
+	// EncryptionKey is the AES-256 key DecryptValues uses. Set via
+	// WithEncryptionKey.
+	EncryptionKey []byte
+	// EncryptionKeyEnv names the environment variable holding the
+	// base64-encoded key when EncryptionKey is not set. Set via
+	// WithEncryptionKeyEnv.
+	EncryptionKeyEnv string
+
+	// sensitive tracks the decrypted and resolved secret values by the
+	// paths holding them.
+	sensitive sensitiveMarks
 }
 
 // UpdateFromEnv finds environment variables whose keys contain the
 // configured delimiter and merges their values into the settings.
-// If an EnvPrefix is configured, only matching env vars are considered.
-func (ve *ViperEx) UpdateFromEnv() {
-	potential := ve.getPotentialEnvVariables()
-	for key, value := range potential {
-		ve.UpdateDeepPath(key, value)
+// Variables are applied in a fixed order: by prefix precedence, then
+// parents before children, then by name. Keys that only differ in case
+// collide; the lexically last variable wins and the collision is listed in
+// the report.
+// Variables of DotEnvFiles are applied the same way; by default the
+// environment wins over them. A dotenv file that cannot be read or parsed
+// fails the update before anything is applied.
+// If an EnvFileSuffix is configured, variables ending with it are read from
+// the file they name; read errors are reported like rejected values.
+// If env prefixes are configured, only matching env vars are considered;
+// values carrying a later prefix of EnvPrefixes win over earlier ones, and
+// single-segment keys such as APP_name override top-level settings too. To
+// keep unrelated variables like APP_PATH from clobbering settings, a
+// single-segment key only replaces an existing top-level scalar value; it
+// never creates a key or replaces a whole section, and it is reported as
+// unmatched with ErrNotTopLevelScalar otherwise.
+// The returned report lists every applied value with its old and new value,
+// every variable whose value was skipped, and every variable that did not
+// resolve to a path together with the reason.
+// If CoerceEnvTypes is enabled, values that cannot be converted to the type
+// of the value they replace are skipped and also reported in the returned
+// error, as are invalid JSON values if EnvJSONValues is enabled.
+// The variables are applied to a copy that replaces AllSettings, in every
+// mode. If StrictEnv is enabled and an env prefix is configured, unmatched
+// variables are reported as an *UnmatchedEnvError and, like any other
+// error, discard the copy so that the settings are left untouched.
+func (ve *ViperEx) UpdateFromEnv() (*UpdateReport, error) {
+	variables, err := ve.getPotentialEnvVariables()
+	if err != nil {
+		return nil, err
+	}
+	return ve.applyEnvVariables(variables)
+}
+
+// applyEnvVariables orders the variables with orderEnvVariables and applies
+// them as described for UpdateFromEnv.
+func (ve *ViperEx) applyEnvVariables(variables []envVariable) (*UpdateReport, error) {
+	potential, collisions := ve.orderEnvVariables(variables)
+	strict := ve.StrictEnv && len(ve.envPrefixes()) > 0
+	report := &UpdateReport{Collisions: collisions}
+	var err error
+	ve.atomically(func() error {
+		for _, variable := range potential {
+			if !strings.Contains(variable.key, ve.KeyDelimiter) && !ve.isTopLevelScalar(variable.key) {
+				// a prefix such as APP_ also matches unrelated vars like APP_PATH
+				report.Unmatched = append(report.Unmatched, UnmatchedKey{
+					Key:    variable.key,
+					Prefix: variable.prefix,
+					Reason: fmt.Errorf("%q: %w", strings.ToLower(variable.key), ErrNotTopLevelScalar),
+				})
+				continue
+			}
+			value := variable.value
+			if variable.file {
+				content, err := readValueFile(variable.value)
+				if err != nil {
+					report.Skipped = append(report.Skipped, SkippedKey{Key: variable.key, Value: variable.value, Err: err})
+					continue
+				}
+				value = content
+			}
+			unmatched := len(report.Unmatched)
+			ve.updateFromString(variable.key, value, report)
+			for i := unmatched; i < len(report.Unmatched); i++ {
+				report.Unmatched[i].Prefix = variable.prefix
+			}
+		}
+		err = report.err()
+		if !strict {
+			// keep whatever could be applied
+			return nil
+		}
+		if len(report.Unmatched) > 0 {
+			err = errors.Join(err, &UnmatchedEnvError{Unmatched: report.Unmatched})
+		}
+		return err
+	})
+	return report, err
+}
+
+// atomically runs update against a deep copy of the settings and keeps the
+// copy only if update succeeds, see AllSettings.
+func (ve *ViperEx) atomically(update func() error) error {
+	original := ve.AllSettings
+	ve.AllSettings = normalizeSettings(original)
+	if err := update(); err != nil {
+		ve.AllSettings = original
+		return err
 	}
+	return nil
 }
 
 // Find returns the value at the given deep-path key and true if found,
-// or nil and false if the path does not exist.
+// or nil and false if the path does not exist. If the key contains "*"
+// wildcard segments, the first match in FindAll order is returned.
 func (ve *ViperEx) Find(key string) (interface{}, bool) {
-	lcaseKey := strings.ToLower(key)
-	path := strings.Split(lcaseKey, ve.KeyDelimiter)
+	path, ok := ve.splitKey(key)
+	if !ok {
+		return nil, false
+	}
+	if hasWildcard(path) {
+		matches := ve.FindAll(key)
+		if len(matches) == 0 {
+			return nil, false
+		}
+		return matches[0].Value, true
+	}
+	deepestEntity := ve.deepSearch(ve.AllSettings, path[:len(path)-1])
+	return stepInto(deepestEntity, path[len(path)-1])
+}
 
-	lastKey := strings.ToLower(path[len(path)-1])
+// Match is a value found by FindAll together with the concrete deep-path
+// key it was found at.
+type Match struct {
+	// Key is the lowercased deep-path key of the value, with every
+	// wildcard replaced by the map key or array index it matched.
+	Key string
+	// Value is the value found at Key.
+	Value interface{}
+}
 
-	path = path[0 : len(path)-1]
-	if len(lastKey) == 0 {
-		return nil, false
+// FindAll returns every value matching the given deep-path key. A "*"
+// segment matches all keys of a map or all indexes of an array. Matches are
+// ordered by map key and array index. A key without wildcards yields at
+// most one match.
+func (ve *ViperEx) FindAll(key string) []Match {
+	path, ok := ve.splitKey(key)
+	if !ok {
+		return nil
 	}
+	var matches []Match
+	visitMatches(ve.AllSettings, path, 0, func(concrete []pathSegment, value interface{}) {
+		matches = append(matches, Match{
+			Key:   ve.joinPath(concrete),
+			Value: value,
+		})
+	})
+	return matches
+}
 
-	deepestEntity := ve.deepSearch(ve.AllSettings, path)
-	deepestMap, ok := deepestEntity.(map[string]interface{})
-	if ok {
-		val, exists := deepestMap[lastKey]
-		return val, exists
+// visitMatches calls visit for every value matching path[depth:] below
+// node, passing the concrete path with wildcards and selectors resolved.
+// Segments already resolved are concrete in path[:depth].
+func visitMatches(node interface{}, path []pathSegment, depth int, visit func([]pathSegment, interface{})) {
+	if depth == len(path) {
+		visit(path, node)
+		return
 	}
+	if !path[depth].wildcard {
+		seg, ok := path[depth].resolve(node)
+		if !ok {
+			return
+		}
+		child, ok := stepInto(node, seg)
+		if ok {
+			visitMatches(child, withSegment(path, depth, seg), depth+1, visit)
+		}
+		return
+	}
+	for _, seg := range childKeys(node) {
+		child, _ := stepInto(node, seg)
+		visitMatches(child, withSegment(path, depth, seg), depth+1, visit)
+	}
+}
 
-	deepestArray, ok := deepestEntity.([]interface{})
-	if ok {
-		// lastKey has to be a num
-		idx, err := strconv.Atoi(lastKey)
-		if err == nil && idx >= 0 && idx < len(deepestArray) {
-			return deepestArray[idx], true
+// expandPath resolves the wildcards and selectors in path[depth:] below
+// node and returns one concrete path per existing branch. The rest of a
+// path after its last wildcard or selector is kept as is, so the returned
+// paths may address values that do not exist yet.
+func expandPath(node interface{}, path []pathSegment, depth int) [][]pathSegment {
+	rest := depth
+	for rest < len(path) && !path[rest].wildcard && !path[rest].selector {
+		rest++
+	}
+	if rest == len(path) {
+		return [][]pathSegment{path}
+	}
+	// walk the literal segments in front of the wildcard or selector
+	for i := depth; i < rest; i++ {
+		child, ok := stepInto(node, path[i])
+		if !ok {
+			return nil
 		}
+		node = child
+	}
+	var segments []pathSegment
+	if path[rest].wildcard {
+		segments = childKeys(node)
+	} else if seg, ok := path[rest].resolve(node); ok {
+		segments = []pathSegment{seg}
 	}
+	var expanded [][]pathSegment
+	for _, seg := range segments {
+		child, _ := stepInto(node, seg)
+		expanded = append(expanded, expandPath(child, withSegment(path, rest, seg), rest+1)...)
+	}
+	return expanded
+}
 
-	return nil, false
+// lookupPath returns the value at a concrete path below node.
+func lookupPath(node interface{}, path []pathSegment) (interface{}, bool) {
+	for _, seg := range path {
+		child, ok := stepInto(node, seg)
+		if !ok {
+			return nil, false
+		}
+		node = child
+	}
+	return node, true
+}
+
+// childKeys returns segments for the sorted keys of a map or the indexes
+// of an array, or nil for any other value.
+func childKeys(node interface{}) []pathSegment {
+	switch container := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(container))
+		for key := range container {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		segments := make([]pathSegment, len(keys))
+		for i, key := range keys {
+			segments[i] = literalSegment(key)
+		}
+		return segments
+	case []interface{}:
+		segments := make([]pathSegment, len(container))
+		for i := range container {
+			segments[i] = literalSegment(strconv.Itoa(i))
+		}
+		return segments
+	}
+	return nil
 }
 
 // UpdateDeepPath updates the value at the given deep-path key, returning
 // true if the path was found and updated, or false if the path does not exist.
+// When CreateMissing is enabled, missing map nodes along the path and the
+// final key are created instead. When GrowArrays is enabled, arrays are
+// extended to reach an out-of-range index. A "*" segment fans out across
+// all existing map keys or array indexes; the update reports true if at
+// least one of them was updated. A selector such as eggs[name=bob] (or the
+// env-safe eggs_WHERE_name_EQ_bob) addresses the first array element whose
+// field matches. Wildcards and selectors only match existing keys and
+// elements, but the rest of the path below each match follows the
+// CreateMissing and GrowArrays rules: with CreateMissing,
+// nest__eggs__*__color adds color to every existing egg.
 func (ve *ViperEx) UpdateDeepPath(key string, value interface{}) bool {
-	lcaseKey := strings.ToLower(key)
-	path := strings.Split(lcaseKey, ve.KeyDelimiter)
+	path, ok := ve.splitKey(key)
+	if !ok {
+		return false
+	}
+	_, ok = ve.setIn(ve.AllSettings, path, 0, value)
+	return ok
+}
 
-	lastKey := strings.ToLower(path[len(path)-1])
+// RemoveDeepPath removes the value at the given deep-path key, returning
+// true if something was removed. Map keys are deleted; array elements are
+// spliced out and the following elements shift down by one.
+func (ve *ViperEx) RemoveDeepPath(key string) bool {
+	path, ok := ve.splitKey(key)
+	if !ok {
+		return false
+	}
+	return ve.removePath(path)
+}
 
-	path = path[0 : len(path)-1]
-	if len(lastKey) == 0 {
+// removePath removes the value at path from the settings and moves the
+// sensitive marks of the elements that follow it along.
+func (ve *ViperEx) removePath(path []pathSegment) bool {
+	concrete, ok := concretePath(ve.AllSettings, path)
+	if !ok {
 		return false
 	}
+	if _, ok := removeIn(ve.AllSettings, concrete, 0); !ok {
+		return false
+	}
+	ve.sensitive = ve.sensitive.removed(ve.AllSettings, concrete)
+	return true
+}
+
+// removeIn removes path[depth:] below node. It returns the node that must
+// be stored back into the parent, which differs from node when an element
+// was spliced out of node.
+func removeIn(node interface{}, path []pathSegment, depth int) (interface{}, bool) {
+	seg, ok := path[depth].resolve(node)
+	if !ok {
+		return node, false
+	}
+	key := seg.key
+	last := depth == len(path)-1
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, exists := container[key]
+		if !exists {
+			return node, false
+		}
+		if last {
+			delete(container, key)
+			return node, true
+		}
+		newChild, ok := removeIn(child, path, depth+1)
+		if !ok {
+			return node, false
+		}
+		container[key] = newChild
+		return node, true
+	case []interface{}:
+		idx, ok := seg.index()
+		if !ok || idx >= len(container) {
+			return node, false
+		}
+		if last {
+			// splice into a new array so that other references are unaffected
+			spliced := make([]interface{}, 0, len(container)-1)
+			spliced = append(spliced, container[:idx]...)
+			spliced = append(spliced, container[idx+1:]...)
+			return spliced, true
+		}
+		newChild, ok := removeIn(container[idx], path, depth+1)
+		if !ok {
+			return node, false
+		}
+		container[idx] = newChild
+		return node, true
+	}
+	return node, false
+}
+
+// setIn stores value at path[depth:] below node, where path[:depth] is the
+// path of node itself. It returns the node that must be stored back into
+// the parent, which differs from node when node is an array that had to
+// grow.
+func (ve *ViperEx) setIn(node interface{}, path []pathSegment, depth int, value interface{}) (interface{}, bool) {
+	if path[depth].wildcard {
+		return ve.setEach(node, path, depth, value)
+	}
+	seg, ok := path[depth].resolve(node)
+	if !ok {
+		return node, false
+	}
+	if path[depth].selector {
+		// keep the path concrete for arrayTemplate
+		path = withSegment(path, depth, seg)
+	}
+	key := seg.key
+	last := depth == len(path)-1
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, exists := container[key]
+		if last {
+			if !exists && !ve.CreateMissing {
+				return node, false
+			}
+			container[key] = value
+			return node, true
+		}
+		if child == nil {
+			if !ve.CreateMissing {
+				return node, false
+			}
+			// intermediate node is created, it is only attached on success
+			child = ve.newContainer(path[depth+1])
+		}
+		newChild, ok := ve.setIn(child, path, depth+1, value)
+		if !ok {
+			return node, false
+		}
+		container[key] = newChild
+		return node, true
+	case []interface{}:
+		// key has to be a num
+		idx, ok := seg.index()
+		if !ok {
+			return node, false
+		}
+		if idx >= len(container) {
+			if !ve.GrowArrays {
+				return node, false
+			}
+			// grow into a copy, it is only attached on success
+			grown := make([]interface{}, idx+1)
+			copy(grown, container)
+			container = grown
+		}
+		if last {
+			container[idx] = value
+			return container, true
+		}
+		child := container[idx]
+		if child == nil {
+			child = ve.arrayTemplate(container, path[:depth])
+		}
+		if child == nil {
+			if !ve.CreateMissing {
+				return node, false
+			}
+			child = ve.newContainer(path[depth+1])
+		}
+		newChild, ok := ve.setIn(child, path, depth+1, value)
+		if !ok {
+			return node, false
+		}
+		container[idx] = newChild
+		return container, true
+	}
+	// scalar in the middle of the path
+	return node, false
+}
 
-	deepestEntity := ve.deepSearch(ve.AllSettings, path)
-	deepestMap, ok := deepestEntity.(map[string]interface{})
-	if ok {
-		// set innermost value
-		_, ok := deepestMap[lastKey]
+// setEach stores value below every existing child of node, expanding the
+// wildcard at path[depth]. It reports true if at least one child was updated.
+func (ve *ViperEx) setEach(node interface{}, path []pathSegment, depth int, value interface{}) (interface{}, bool) {
+	updated := false
+	for _, seg := range childKeys(node) {
+		concrete := withSegment(path, depth, seg)
+		newNode, ok := ve.setIn(node, concrete, depth, value)
 		if ok {
-			deepestMap[lastKey] = value
-			return true
+			node = newNode
+			updated = true
 		}
+	}
+	return node, updated
+}
+
+// arrayTemplate returns a deep copy of the template for new elements of the
+// array at arrayPath, or nil if there is none. A template registered via
+// WithArrayTemplate takes precedence over the first element of the array.
+func (ve *ViperEx) arrayTemplate(array []interface{}, arrayPath []pathSegment) interface{} {
+	var template interface{}
+	if templateKey, ok := ve.ArrayTemplates[ve.joinPath(arrayPath)]; ok {
+		template, _ = ve.Find(templateKey)
+	} else if ve.CloneFirstElement && len(array) > 0 {
+		template = array[0]
+	}
+	switch template.(type) {
+	case map[string]interface{}, []interface{}:
+		return normalizeValue(template)
+	}
+	return nil
+}
+
+// newContainer returns the empty node created for a missing or nil path
+// segment. When arrays may grow and the following segment is an index, an
+// array is created so that the index can be filled; otherwise a map is
+// created.
+func (ve *ViperEx) newContainer(next pathSegment) interface{} {
+	if ve.GrowArrays && !next.wildcard && !next.selector {
+		if _, ok := next.index(); ok {
+			return []interface{}{}
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// isTopLevelScalar reports whether the settings hold a scalar value at the
+// top-level key.
+func (ve *ViperEx) isTopLevelScalar(key string) bool {
+	value, ok := ve.AllSettings[strings.ToLower(key)]
+	if !ok {
 		return false
 	}
-	// is this an array
-	deepestArray, ok := deepestEntity.([]interface{})
-	if ok {
-		// lastKey has to be a num
-		idx, err := strconv.Atoi(lastKey)
-		if err == nil {
-			if idx < len(deepestArray) && idx >= 0 {
-				deepestArray[idx] = value
-				return true
-			}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// envPrefixes returns the configured env prefixes in increasing order of
+// precedence.
+func (ve *ViperEx) envPrefixes() []string {
+	if len(ve.EnvPrefixes) > 0 {
+		return ve.EnvPrefixes
+	}
+	if len(ve.EnvPrefix) > 0 {
+		return []string{ve.EnvPrefix}
+	}
+	return nil
+}
+
+// matchEnvPrefix returns the longest configured prefix name starts with and
+// its rank. It returns false if prefixes are configured and none matches.
+func (ve *ViperEx) matchEnvPrefix(name string) (string, int, bool) {
+	prefixes := ve.envPrefixes()
+	if len(prefixes) == 0 {
+		return "", 0, true
+	}
+	match := -1
+	for i, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) && (match < 0 || len(prefix) > len(prefixes[match])) {
+			match = i
 		}
 	}
-	return false
+	if match < 0 {
+		return "", 0, false
+	}
+	return prefixes[match], match, true
 }
-func (ve *ViperEx) getPotentialEnvVariables() map[string]string {
-	var result map[string]string
-	result = make(map[string]string)
-	for _, element := range os.Environ() {
+
+// getPotentialEnvVariables returns the env vars UpdateFromEnv considers,
+// including those of the DotEnvFiles. It fails if a dotenv file cannot be
+// read or parsed.
+func (ve *ViperEx) getPotentialEnvVariables() ([]envVariable, error) {
+	// dotenv files rank below the environment unless DotEnvOverridesEnv
+	envSource, dotEnvSource := len(ve.DotEnvFiles), 0
+	if ve.DotEnvOverridesEnv {
+		envSource, dotEnvSource = 0, 1
+	}
+	var variables []envVariable
+	for _, element := range ve.environ() {
 		var index = strings.Index(element, "=")
-		key := element[0:index]
-		// check for prefix
-		if len(ve.EnvPrefix) > 0 {
-			if !strings.HasPrefix(key, ve.EnvPrefix) {
-				continue
-			}
-			key = key[len(ve.EnvPrefix):]
+		if index < 0 {
+			continue
+		}
+		variable, ok := ve.newEnvVariable(element[0:index], element[index+1:], ve.EnvFileSuffix)
+		if ok {
+			variable.source = envSource
+			variables = append(variables, variable)
+		}
+	}
+	for i, path := range ve.DotEnvFiles {
+		dotEnv, err := readDotEnvFile(path)
+		if err != nil {
+			return nil, err
 		}
-		value := element[index+1:]
-		if strings.Contains(key, ve.KeyDelimiter) {
-			result[key] = value
+		for name, value := range dotEnv {
+			variable, ok := ve.newEnvVariable(name, value, ve.EnvFileSuffix)
+			if ok {
+				variable.source = dotEnvSource + i
+				variables = append(variables, variable)
+			}
 		}
 	}
-	return result
+	return variables, nil
 }
 
-// deepSearch walks the settings tree along the given path segments.
-// It supports maps and arrays but does not support nested arrays-of-arrays;
-// when an array element is itself an array, the search returns nil.
-func (ve *ViperEx) deepSearch(m map[string]interface{}, path []string) interface{} {
-	if len(path) == 0 {
-		return m
+// newEnvVariable applies the prefix rules to the variable name. A name
+// ending with a non-empty fileSuffix refers to a file holding the value. It
+// returns false if the variable is not meant for the settings.
+func (ve *ViperEx) newEnvVariable(name string, value string, fileSuffix string) (envVariable, bool) {
+	prefix, rank, ok := ve.matchEnvPrefix(name)
+	if !ok {
+		return envVariable{}, false
+	}
+	key := name[len(prefix):]
+	file := len(fileSuffix) > 0 && strings.HasSuffix(key, fileSuffix)
+	if file {
+		key = strings.TrimSuffix(key, fileSuffix)
+	}
+	// single-segment keys are only unambiguous with a prefix
+	if !strings.Contains(key, ve.KeyDelimiter) && (len(prefix) == 0 || len(key) == 0) {
+		return envVariable{}, false
 	}
-	var stepArray = false
-	var currentArray []interface{}
-	var currentEntity interface{}
+	return envVariable{name: name, prefix: prefix, key: key, value: value, rank: rank, file: file}, true
+}
+
+// deepSearch walks the settings tree along the given path segments and
+// returns the container (map or array) found at the end of the path.
+// Maps and arrays may be nested in any combination, including
+// arrays-of-arrays. It returns nil if a segment does not exist or if the
+// path runs into a scalar value.
+func (ve *ViperEx) deepSearch(m map[string]interface{}, path []pathSegment) interface{} {
+	var currentEntity interface{} = m
 	for _, k := range path {
-		if stepArray {
-			idx, err := strconv.Atoi(k)
-			if err != nil {
-				return nil
-			}
-			if len(currentArray) <= idx {
-				return nil
-			}
-			m3, ok := currentArray[idx].(map[string]interface{})
-			if !ok {
-				return nil
-			}
+		next, ok := stepInto(currentEntity, k)
+		if !ok {
+			return nil
+		}
+		switch next.(type) {
+		case map[string]interface{}, []interface{}:
 			// continue search from here
-			m = m3
-			currentEntity = m
-			stepArray = false // don't support arrays of arrays
-		} else {
-			m2, ok := m[k]
-			if !ok {
-				// intermediate key does not exist
-				return nil
-			}
-			m3, ok := m2.(map[string]interface{})
-			if !ok {
-				// is this an array
-				m4, ok := m2.([]interface{})
-				if ok {
-					// continue search from here
-					currentArray = m4
-					currentEntity = currentArray
-					stepArray = true
-					m3 = nil
-				} else {
-					// intermediate key is a value
-					return nil
-				}
-			} else {
-				// continue search from here
-				m = m3
-				currentEntity = m
-			}
+			currentEntity = next
+		default:
+			// intermediate key is a value
+			return nil
 		}
 	}
-
 	return currentEntity
 }
 
+// stepInto returns the child of entity addressed by seg. Maps are indexed
+// by key and arrays by the numeric value of key or by a selector.
+func stepInto(entity interface{}, seg pathSegment) (interface{}, bool) {
+	seg, ok := seg.resolve(entity)
+	if !ok {
+		return nil, false
+	}
+	key := seg.key
+	switch container := entity.(type) {
+	case map[string]interface{}:
+		val, ok := container[key]
+		return val, ok
+	case []interface{}:
+		idx, ok := seg.index()
+		if !ok || idx >= len(container) {
+			return nil, false
+		}
+		return container[idx], true
+	}
+	return nil, false
+}
+
 // code copied from the viper project
 
 // defaultDecoderConfig returns default mapstructure.DecoderConfig with support
@@ -304,4 +1022,3 @@ func decode(input interface{}, config *mapstructure.DecoderConfig) error {
 	}
 	return decoder.Decode(input)
 }
-
@@ -385,6 +385,403 @@ func TestUpdateDeepPath_ReturnValue(t *testing.T) {
 	assert.False(t, ve.UpdateDeepPath("name__", "value"))
 }
 
+func TestUpdateDeepPath_CreateMissing(t *testing.T) {
+	settings := map[string]interface{}{
+		"name": "bob",
+		"nest": map[string]interface{}{
+			"tags":  []interface{}{"A", map[string]interface{}{}},
+			"empty": nil,
+		},
+	}
+
+	// strict mode stays the default
+	strict, err := New(settings, WithDelimiter("__"))
+	require.NoError(t, err)
+	assert.False(t, strict.CreateMissing)
+	assert.False(t, strict.UpdateDeepPath("db__host", "localhost"))
+	_, found := strict.Find("db")
+	assert.False(t, found)
+
+	ve, err := New(settings, WithDelimiter("__"), WithCreateMissing())
+	require.NoError(t, err)
+	assert.True(t, ve.CreateMissing)
+
+	// missing leaf in an existing map
+	assert.True(t, ve.UpdateDeepPath("nest__color", "brown"))
+	val, found := ve.Find("nest__color")
+	assert.True(t, found)
+	assert.Equal(t, "brown", val)
+
+	// missing intermediate maps
+	assert.True(t, ve.UpdateDeepPath("db__primary__Host", "localhost"))
+	val, found = ve.Find("db__primary__host")
+	assert.True(t, found)
+	assert.Equal(t, "localhost", val)
+
+	// null intermediate is treated as missing
+	assert.True(t, ve.UpdateDeepPath("nest__empty__value", 1))
+	val, found = ve.Find("nest__empty__value")
+	assert.True(t, found)
+	assert.Equal(t, 1, val)
+
+	// maps inside arrays
+	assert.True(t, ve.UpdateDeepPath("nest__tags__1__a__b", "c"))
+	val, found = ve.Find("nest__tags__1__a__b")
+	assert.True(t, found)
+	assert.Equal(t, "c", val)
+
+	// scalars are never replaced by maps and arrays are not extended
+	assert.False(t, ve.UpdateDeepPath("name__first", "bob"))
+	assert.False(t, ve.UpdateDeepPath("nest__tags__0__x", "y"))
+	assert.False(t, ve.UpdateDeepPath("nest__tags__5", "y"))
+	assert.False(t, ve.UpdateDeepPath("name__deep__path", "bob"))
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+
+	// numeric segments below created nodes are map keys
+	assert.True(t, ve.UpdateDeepPath("fresh__0__name", "zero"))
+	val, found = ve.Find("fresh")
+	assert.True(t, found)
+	assert.Equal(t, map[string]interface{}{"0": map[string]interface{}{"name": "zero"}}, val)
+
+	// empty segments are rejected
+	assert.False(t, ve.UpdateDeepPath("db____host", "x"))
+	assert.False(t, ve.UpdateDeepPath("db__", "x"))
+}
+
+func TestRemoveDeepPath(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	// map key
+	assert.True(t, myViperEx.RemoveDeepPath("nestedMap__Eggs__betty"))
+	_, found := myViperEx.Find("nestedMap__Eggs__betty")
+	assert.False(t, found)
+	_, found = myViperEx.Find("nestedMap__Eggs__bob")
+	assert.True(t, found)
+
+	// array element, the rest shift down
+	assert.True(t, myViperEx.RemoveDeepPath("nest__Eggs__0"))
+	eggs, found := myViperEx.Find("nest__Eggs")
+	assert.True(t, found)
+	assert.Len(t, eggs, 1)
+	weight, found := myViperEx.Find("nest__Eggs__0__Weight")
+	assert.True(t, found)
+	assert.Equal(t, float64(13), weight)
+
+	// nested array element
+	assert.True(t, myViperEx.RemoveDeepPath("nest__Eggs__0__SomeStrings__1"))
+	strs, found := myViperEx.Find("nest__Eggs__0__SomeStrings")
+	assert.True(t, found)
+	assert.Equal(t, []interface{}{"a", "c"}, strs)
+
+	// whole subtree
+	assert.True(t, myViperEx.RemoveDeepPath("MasterEgg"))
+	_, found = myViperEx.Find("MasterEgg__name")
+	assert.False(t, found)
+
+	// nothing to remove
+	assert.False(t, myViperEx.RemoveDeepPath("MasterEgg"))
+	assert.False(t, myViperEx.RemoveDeepPath("nest__junk"))
+	assert.False(t, myViperEx.RemoveDeepPath("nest__Eggs__5"))
+	assert.False(t, myViperEx.RemoveDeepPath("nest__Eggs__-1"))
+	assert.False(t, myViperEx.RemoveDeepPath("name__first"))
+	assert.False(t, myViperEx.RemoveDeepPath("nest__"))
+
+	settings := Settings{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+	assert.Len(t, settings.Nest.Eggs, 1)
+	assert.Equal(t, int32(13), settings.Nest.Eggs[0].Weight)
+}
+
+func TestRemoveDeepPath_ArraysOfArrays(t *testing.T) {
+	grid := []interface{}{
+		[]interface{}{"a", "b"},
+		[]interface{}{"c", "d"},
+	}
+	ve, err := New(map[string]interface{}{"grid": grid}, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	assert.True(t, ve.RemoveDeepPath("grid__1__0"))
+	assert.True(t, ve.RemoveDeepPath("grid__0"))
+	assert.Equal(t, []interface{}{[]interface{}{"d"}}, ve.AllSettings["grid"])
+	assert.True(t, ve.RemoveDeepPath("grid__0__0"))
+	assert.Equal(t, []interface{}{[]interface{}{}}, ve.AllSettings["grid"])
+}
+
+func TestWildcardPaths(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	// fan-out query with concrete keys
+	matches := myViperEx.FindAll("nest__eggs__*__weight")
+	assert.Equal(t, []Match{
+		{Key: "nest__eggs__0__weight", Value: float64(12)},
+		{Key: "nest__eggs__1__weight", Value: float64(13)},
+	}, matches)
+
+	matches = myViperEx.FindAll("nestedMap__eggs__*__somevalues__*__value")
+	keys := make([]string, 0, len(matches))
+	for _, match := range matches {
+		keys = append(keys, match.Key)
+	}
+	assert.Equal(t, []string{
+		"nestedmap__eggs__betty__somevalues__0__value",
+		"nestedmap__eggs__betty__somevalues__1__value",
+		"nestedmap__eggs__bob__somevalues__0__value",
+		"nestedmap__eggs__bob__somevalues__1__value",
+	}, keys)
+
+	// without wildcards FindAll yields at most one match
+	assert.Len(t, myViperEx.FindAll("nest__name"), 1)
+	assert.Empty(t, myViperEx.FindAll("nest__junk"))
+	assert.Empty(t, myViperEx.FindAll("nest__tags__*__x"))
+
+	// Find returns the first match
+	val, found := myViperEx.Find("nestedMap__eggs__*__weight")
+	assert.True(t, found)
+	assert.Equal(t, float64(13), val)
+	_, found = myViperEx.Find("nest__eggs__*__junk")
+	assert.False(t, found)
+
+	// bulk updates
+	assert.True(t, myViperEx.UpdateDeepPath("nest__eggs__*__weight", 7))
+	assert.True(t, myViperEx.UpdateDeepPath("nestedMap__eggs__*__somestrings__*", "z"))
+	assert.False(t, myViperEx.UpdateDeepPath("nest__eggs__*__junk", 1))
+	assert.False(t, myViperEx.UpdateDeepPath("name__*", 1))
+
+	// a trailing wildcard replaces every element
+	assert.True(t, myViperEx.UpdateDeepPath("nest__tags__*", "all"))
+
+	settings := Settings{}
+	err = myViperEx.Unmarshal(&settings)
+	require.NoError(t, err)
+	for _, egg := range settings.Nest.Eggs {
+		assert.Equal(t, int32(7), egg.Weight)
+	}
+	assert.Equal(t, []string{"all"}, settings.Nest.Tags)
+
+	mapSettings := SettingsWithNestedMap{}
+	err = myViperEx.Unmarshal(&mapSettings)
+	require.NoError(t, err)
+	for _, egg := range mapSettings.NestedMap.Eggs {
+		assert.Equal(t, []string{"z", "z", "z"}, egg.SomeStrings)
+	}
+}
+
+func TestWildcardCreateMissing(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{
+				map[string]interface{}{"name": "alice"},
+				map[string]interface{}{"name": "bob", "tags": []interface{}{"a"}},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithCreateMissing(), WithArrayGrowth())
+	require.NoError(t, err)
+
+	// the key below the wildcard is created in every existing match
+	assert.True(t, ve.UpdateDeepPath("nest__eggs__*__color", "red"))
+	assert.Equal(t, []Match{
+		{Key: "nest__eggs__0__color", Value: "red"},
+		{Key: "nest__eggs__1__color", Value: "red"},
+	}, ve.FindAll("nest__eggs__*__color"))
+	assert.True(t, ve.UpdateDeepPath("nest__eggs__*__tags__1", "b"))
+	val, _ := ve.Find("nest__eggs__0__tags")
+	assert.Equal(t, []interface{}{nil, "b"}, val)
+	val, _ = ve.Find("nest__eggs__1__tags")
+	assert.Equal(t, []interface{}{"a", "b"}, val)
+
+	// the wildcard itself never creates anything
+	assert.False(t, ve.UpdateDeepPath("nest__nests__*__color", "red"))
+	_, found := ve.Find("nest__nests")
+	assert.False(t, found)
+	assert.False(t, ve.UpdateDeepPath("nest__eggs__0__name__*", "x"))
+	assert.Len(t, ve.FindAll("nest__eggs__*"), 2)
+}
+
+func TestWildcardEnv(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs__*__weight", "42")
+	myViperEx.UpdateFromEnv()
+
+	for _, match := range myViperEx.FindAll("nest__eggs__*__weight") {
+		assert.Equal(t, "42", match.Value, match.Key)
+	}
+}
+
+func TestSelectorPaths(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{
+				map[string]interface{}{"name": "alice", "weight": 1, "tags": []interface{}{"a"}},
+				map[string]interface{}{"name": "Bob", "weight": 2, "tags": []interface{}{"b"}},
+				map[string]interface{}{"name": "bob", "weight": 3},
+				"not-a-map",
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	// the first matching element wins and values compare without case
+	val, found := ve.Find("nest__eggs[name=bob]__weight")
+	assert.True(t, found)
+	assert.Equal(t, 2, val)
+
+	// a selector may also be its own segment
+	val, found = ve.Find("nest__eggs__[weight=3]__name")
+	assert.True(t, found)
+	assert.Equal(t, "bob", val)
+
+	// env-safe form
+	val, found = ve.Find("nest__eggs_WHERE_name_EQ_alice__weight")
+	assert.True(t, found)
+	assert.Equal(t, 1, val)
+
+	_, found = ve.Find("nest__eggs[name=carol]__weight")
+	assert.False(t, found)
+	_, found = ve.Find("nest[name=bob]")
+	assert.False(t, found)
+
+	assert.True(t, ve.UpdateDeepPath("nest__eggs[name=alice]__weight", 10))
+	assert.True(t, ve.UpdateDeepPath("nest__eggs[name=bob]__tags__0", "z"))
+	assert.False(t, ve.UpdateDeepPath("nest__eggs[name=carol]__weight", 10))
+	assert.False(t, ve.UpdateDeepPath("nest__eggs[=bob]__weight", 10))
+
+	matches := ve.FindAll("nest__eggs[name=bob]__*")
+	assert.Equal(t, []Match{
+		{Key: "nest__eggs__1__name", Value: "Bob"},
+		{Key: "nest__eggs__1__tags", Value: []interface{}{"z"}},
+		{Key: "nest__eggs__1__weight", Value: 2},
+	}, matches)
+
+	val, _ = ve.Find("nest__eggs__0__weight")
+	assert.Equal(t, 10, val)
+
+	// selectors work with removal too
+	assert.True(t, ve.RemoveDeepPath("nest__eggs[name=alice]"))
+	val, _ = ve.Find("nest__eggs__0__name")
+	assert.Equal(t, "Bob", val)
+}
+
+func TestSelectorEnv(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"eggs": []interface{}{
+				map[string]interface{}{"name": "alice", "weight": 1},
+				map[string]interface{}{"name": "bob", "weight": 2},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs_WHERE_name_EQ_bob__weight", "20")
+	t.Setenv("NEST__EGGS_WHERE_NAME_EQ_ALICE__WEIGHT", "10")
+	ve.UpdateFromEnv()
+
+	settingsOut := Settings{}
+	err = ve.Unmarshal(&settingsOut)
+	require.NoError(t, err)
+	assert.Equal(t, int32(10), settingsOut.Nest.Eggs[0].Weight)
+	assert.Equal(t, int32(20), settingsOut.Nest.Eggs[1].Weight)
+}
+
+func TestSelectorReservedKeys(t *testing.T) {
+	ve, err := New(map[string]interface{}{
+		"sort_where_x_eq_y": "literal",
+	}, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	// the key is read as a selector, not as a literal key
+	_, found := ve.Find("sort_where_x_eq_y")
+	assert.False(t, found)
+	assert.False(t, ve.UpdateDeepPath("sort_where_x_eq_y", "updated"))
+	assert.Equal(t, "literal", ve.AllSettings["sort_where_x_eq_y"])
+}
+
+func TestArraysOfArrays(t *testing.T) {
+	settings := map[string]interface{}{
+		"grid": [][]string{
+			{"a", "b", "c"},
+			{"d", "e", "f"},
+		},
+		"shards": []interface{}{
+			[]interface{}{
+				map[string]interface{}{"host": "alpha"},
+				[]interface{}{"x", "y"},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter("__"))
+	require.NoError(t, err)
+
+	val, found := ve.Find("grid__1__2")
+	assert.True(t, found)
+	assert.Equal(t, "f", val)
+
+	assert.True(t, ve.UpdateDeepPath("grid__1__2", "z"))
+	val, found = ve.Find("grid__1__2")
+	assert.True(t, found)
+	assert.Equal(t, "z", val)
+
+	// maps and arrays nested in any combination
+	assert.True(t, ve.UpdateDeepPath("shards__0__0__host", "beta"))
+	val, found = ve.Find("shards__0__0__host")
+	assert.True(t, found)
+	assert.Equal(t, "beta", val)
+
+	assert.True(t, ve.UpdateDeepPath("shards__0__1__1", "w"))
+	val, found = ve.Find("shards__0__1__1")
+	assert.True(t, found)
+	assert.Equal(t, "w", val)
+
+	// out-of-range and scalar intermediates are not found
+	assert.False(t, ve.UpdateDeepPath("grid__2__0", "q"))
+	assert.False(t, ve.UpdateDeepPath("grid__0__9", "q"))
+	assert.False(t, ve.UpdateDeepPath("grid__0__0__0", "q"))
+	_, found = ve.Find("shards__0__1__1__0")
+	assert.False(t, found)
+
+	type matrixSettings struct {
+		Grid [][]string
+	}
+	matrix := matrixSettings{}
+	err = ve.Unmarshal(&matrix)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e", "z"}}, matrix.Grid)
+}
+
+func TestNormalizeSettings_TypedSlices(t *testing.T) {
+	settings := map[string]interface{}{
+		"Grid":   [][]string{{"a"}},
+		"Ports":  []int{80, 443},
+		"Labels": map[string]int{"Tier": 1},
+		"Raw":    []byte("raw"),
+	}
+	normalized := normalizeSettings(settings)
+	assert.Equal(t, []interface{}{[]interface{}{"a"}}, normalized["grid"])
+	assert.Equal(t, []interface{}{80, 443}, normalized["ports"])
+	assert.Equal(t, map[string]interface{}{"tier": 1}, normalized["labels"])
+	assert.Equal(t, []byte("raw"), normalized["raw"])
+}
+
 func prettyJSON(obj interface{}) string {
 	jsonBytes, err := json.MarshalIndent(obj, "", "    ")
 	if err != nil {
@@ -392,3 +789,64 @@ func prettyJSON(obj interface{}) string {
 	}
 	return string(jsonBytes)
 }
+
+func TestUpdateFromEnv_TopLevelKeys(t *testing.T) {
+	t.Parallel()
+	settings := map[string]interface{}{
+		"name":    "bob",
+		"enabled": false,
+		"nest":    map[string]interface{}{"name": "straw"},
+		"tags":    []interface{}{"a"},
+	}
+	source := WithEnvSource(EnvMap{
+		"APP_NAME":    "alice",
+		"APP_enabled": "true",
+		"APP_nest":    "oops",
+		"APP_tags":    "oops",
+		"APP_PATH":    "/usr/bin",
+		"APP_":        "empty",
+	})
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("APP"), WithCreateMissing(), source)
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 2)
+	// keys that are not top-level scalars are reported, never applied
+	require.Len(t, report.Unmatched, 3)
+	for i, key := range []string{"nest", "PATH", "tags"} {
+		assert.Equal(t, key, report.Unmatched[i].Key)
+		assert.Equal(t, "APP_", report.Unmatched[i].Prefix)
+		assert.ErrorIs(t, report.Unmatched[i].Reason, ErrNotTopLevelScalar)
+	}
+
+	assert.Equal(t, "alice", ve.AllSettings["name"])
+	assert.Equal(t, "true", ve.AllSettings["enabled"])
+	assert.Equal(t, map[string]interface{}{"name": "straw"}, ve.AllSettings["nest"])
+	assert.Equal(t, []interface{}{"a"}, ve.AllSettings["tags"])
+	assert.NotContains(t, ve.AllSettings, "path")
+
+	// strict mode fails on them like on any other unmatched variable
+	ve, err = New(settings, WithDelimiter(keyDelim), WithEnvPrefix("APP"), WithStrictEnv(),
+		WithEnvSource(EnvMap{"APP_NAME": "alice", "APP_nmae": "typo"}))
+	require.NoError(t, err)
+	_, err = ve.UpdateFromEnv()
+	var unmatchedErr *UnmatchedEnvError
+	require.ErrorAs(t, err, &unmatchedErr)
+	require.Len(t, unmatchedErr.Unmatched, 1)
+	assert.Equal(t, "nmae", unmatchedErr.Unmatched[0].Key)
+	assert.ErrorIs(t, unmatchedErr.Unmatched[0].Reason, ErrNotTopLevelScalar)
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+}
+
+func TestUpdateFromEnv_TopLevelKeysNeedPrefix(t *testing.T) {
+	t.Parallel()
+	ve, err := New(map[string]interface{}{"name": "bob"}, WithDelimiter(keyDelim),
+		WithEnvSource(EnvMap{"name": "alice"}))
+	require.NoError(t, err)
+
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Empty(t, report.Applied)
+	assert.Equal(t, "bob", ve.AllSettings["name"])
+}
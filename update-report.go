@@ -0,0 +1,163 @@
+// Copyright © 2020 Herb Stahl <ghstahl@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package viperEx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidKey reports a deep-path key with empty or malformed segments.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrKeyNotFound reports a map key that does not exist.
+	ErrKeyNotFound = errors.New("missing key")
+	// ErrIndexOutOfRange reports an array index beyond the end of the array.
+	ErrIndexOutOfRange = errors.New("index out of range")
+	// ErrInvalidIndex reports an array segment that is not a number.
+	ErrInvalidIndex = errors.New("invalid array index")
+	// ErrNoSelectorMatch reports a selector no array element matches.
+	ErrNoSelectorMatch = errors.New("no element matches selector")
+	// ErrScalarInPath reports a path that runs through a scalar value.
+	ErrScalarInPath = errors.New("scalar in the middle of the path")
+	// ErrNotTopLevelScalar reports a single-segment key, such as APP_PATH
+	// for the prefix APP_, that does not name an existing top-level scalar
+	// setting.
+	ErrNotTopLevelScalar = errors.New("not a top-level scalar setting")
+)
+
+// UpdateReport describes what an update from key/value pairs, such as
+// UpdateFromEnv, did with each candidate key.
+type UpdateReport struct {
+	// Applied lists every value that was written.
+	Applied []AppliedKey
+	// Skipped lists candidate keys whose value was rejected, e.g. because
+	// it could not be converted to the type of the value it replaces.
+	Skipped []SkippedKey
+	// Unmatched lists candidate keys that do not resolve to a path.
+	Unmatched []UnmatchedKey
+	// Collisions lists candidate keys that only differ in case, such as
+	// NEST__name and nest__NAME. Only one of them is applied.
+	Collisions []CollidingKey
+}
+
+// AppliedKey describes a value written by an update.
+type AppliedKey struct {
+	// Key is the candidate key, e.g. the env var name without its prefix.
+	Key string
+	// Path is the concrete deep-path key that was written.
+	Path string
+	// OldValue is the value that was replaced, or nil if it was created.
+	OldValue interface{}
+	// NewValue is the value that was written.
+	NewValue interface{}
+}
+
+// SkippedKey describes a candidate key whose value was rejected.
+type SkippedKey struct {
+	// Key is the candidate key.
+	Key string
+	// Value is the raw value that was rejected.
+	Value string
+	// Err explains why the value was rejected.
+	Err error
+}
+
+// UnmatchedKey describes a candidate key that did not resolve to a path.
+type UnmatchedKey struct {
+	// Key is the candidate key.
+	Key string
+	// Prefix is the env prefix the variable carried, if any.
+	Prefix string
+	// Reason is one of ErrInvalidKey, ErrKeyNotFound, ErrIndexOutOfRange,
+	// ErrInvalidIndex, ErrNoSelectorMatch, ErrScalarInPath or
+	// ErrNotTopLevelScalar, wrapped with the segment it applies to.
+	Reason error
+}
+
+// CollidingKey describes candidate keys that are the same once lowercased.
+type CollidingKey struct {
+	// Key is the lowercased key the candidates collide on.
+	Key string
+	// Names lists the colliding variables in lexical order. The value of
+	// the last one is the one applied.
+	Names []string
+}
+
+// UnmatchedEnvError is returned by UpdateFromEnv in strict mode when
+// prefixed env vars do not resolve to a path.
+type UnmatchedEnvError struct {
+	// Unmatched lists the variables, keyed without their prefix.
+	Unmatched []UnmatchedKey
+}
+
+func (e *UnmatchedEnvError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("unmatched env variables:")
+	for _, unmatched := range e.Unmatched {
+		fmt.Fprintf(&sb, " %s%s (%v);", unmatched.Prefix, unmatched.Key, unmatched.Reason)
+	}
+	return strings.TrimSuffix(sb.String(), ";")
+}
+
+// err joins the errors of all skipped keys, or returns nil.
+func (r *UpdateReport) err() error {
+	var errs []error
+	for _, skipped := range r.Skipped {
+		errs = append(errs, fmt.Errorf("%s: %w", skipped.Key, skipped.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// diagnose explains why path could not be updated. It walks the settings
+// and reports the first segment that cannot be resolved.
+func (ve *ViperEx) diagnose(path []pathSegment) error {
+	var node interface{} = ve.AllSettings
+	for depth, seg := range path {
+		if seg.wildcard {
+			children := childKeys(node)
+			if children == nil {
+				return fmt.Errorf("%q: %w", ve.joinPath(path[:depth]), ErrScalarInPath)
+			}
+			if len(children) == 0 {
+				return fmt.Errorf("%q: %w", ve.joinPath(path[:depth+1]), ErrKeyNotFound)
+			}
+			// explain the first branch
+			seg = children[0]
+		}
+		where := ve.joinPath(path[:depth+1])
+		switch container := node.(type) {
+		case map[string]interface{}:
+			resolved, ok := seg.resolve(node)
+			if !ok {
+				return fmt.Errorf("%q: %w", where, ErrNoSelectorMatch)
+			}
+			child, ok := container[resolved.key]
+			if !ok {
+				return fmt.Errorf("%q: %w", where, ErrKeyNotFound)
+			}
+			node = child
+		case []interface{}:
+			resolved, ok := seg.resolve(node)
+			if !ok {
+				return fmt.Errorf("%q: %w", where, ErrNoSelectorMatch)
+			}
+			idx, err := strconv.Atoi(resolved.key)
+			if err != nil || idx < 0 {
+				return fmt.Errorf("%q: %w", where, ErrInvalidIndex)
+			}
+			if idx >= len(container) {
+				return fmt.Errorf("%q: %w", where, ErrIndexOutOfRange)
+			}
+			node = container[idx]
+		default:
+			return fmt.Errorf("%q: %w", ve.joinPath(path[:depth]), ErrScalarInPath)
+		}
+	}
+	return fmt.Errorf("%q: %w", ve.joinPath(path), ErrKeyNotFound)
+}
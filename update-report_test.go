@@ -0,0 +1,225 @@
+package viperEx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findApplied(report *UpdateReport, path string) (AppliedKey, bool) {
+	for _, applied := range report.Applied {
+		if applied.Path == path {
+			return applied, true
+		}
+	}
+	return AppliedKey{}, false
+}
+
+func findUnmatched(report *UpdateReport, key string) (UnmatchedKey, bool) {
+	for _, unmatched := range report.Unmatched {
+		if unmatched.Key == key {
+			return unmatched, true
+		}
+	}
+	return UnmatchedKey{}, false
+}
+
+func TestUpdateFromEnv_Report(t *testing.T) {
+	configPath := getConfigPath()
+	myViper, err := ReadAppsettings(configPath)
+	require.NoError(t, err)
+
+	myViperEx, err := New(myViper.AllSettings(), WithDelimiter(keyDelim), WithEnvTypeCoercion())
+	require.NoError(t, err)
+
+	t.Setenv("nest__eggs__0__weight", "5")
+	t.Setenv("nest__eggs__*__somestrings__0", "first")
+	t.Setenv("nest__countint", "many")
+	t.Setenv("nest__egs__0__weight", "5")
+	t.Setenv("nest__eggs__7__weight", "5")
+	t.Setenv("nest__eggs__first__weight", "5")
+	t.Setenv("nest__name__first", "5")
+	t.Setenv("nest__eggs_WHERE_name_EQ_nobody__weight", "5")
+	t.Setenv("nest____weight", "5")
+	report, err := myViperEx.UpdateFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nest__countint")
+
+	applied, found := findApplied(report, "nest__eggs__0__weight")
+	require.True(t, found)
+	assert.Equal(t, "nest__eggs__0__weight", applied.Key)
+	assert.Equal(t, float64(12), applied.OldValue)
+	assert.Equal(t, float64(5), applied.NewValue)
+
+	for _, path := range []string{"nest__eggs__0__somestrings__0", "nest__eggs__1__somestrings__0"} {
+		applied, found = findApplied(report, path)
+		require.True(t, found, path)
+		assert.Equal(t, "nest__eggs__*__somestrings__0", applied.Key)
+		assert.Equal(t, "a", applied.OldValue)
+		assert.Equal(t, "first", applied.NewValue)
+	}
+	assert.Len(t, report.Applied, 3)
+
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "nest__countint", report.Skipped[0].Key)
+	assert.Equal(t, "many", report.Skipped[0].Value)
+	assert.Error(t, report.Skipped[0].Err)
+
+	reasons := map[string]error{
+		"nest__egs__0__weight":                    ErrKeyNotFound,
+		"nest__eggs__7__weight":                   ErrIndexOutOfRange,
+		"nest__eggs__first__weight":               ErrInvalidIndex,
+		"nest__name__first":                       ErrScalarInPath,
+		"nest__eggs_WHERE_name_EQ_nobody__weight": ErrNoSelectorMatch,
+		"nest____weight":                          ErrInvalidKey,
+	}
+	assert.Len(t, report.Unmatched, len(reasons))
+	for key, reason := range reasons {
+		unmatched, found := findUnmatched(report, key)
+		require.True(t, found, key)
+		assert.True(t, errors.Is(unmatched.Reason, reason), "%s: %v", key, unmatched.Reason)
+	}
+	unmatched, _ := findUnmatched(report, "nest__egs__0__weight")
+	assert.Contains(t, unmatched.Reason.Error(), `"nest__egs"`)
+}
+
+func TestUpdateFromEnv_ReportCreated(t *testing.T) {
+	settings := map[string]interface{}{
+		"eggs": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b", "color": "blue"},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithCreateMissing())
+	require.NoError(t, err)
+
+	t.Setenv("eggs__*__color", "red")
+	t.Setenv("db__host", "localhost")
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	assert.Empty(t, report.Unmatched)
+	assert.Empty(t, report.Skipped)
+
+	// wildcards create missing leaves in every branch
+	applied, found := findApplied(report, "eggs__0__color")
+	require.True(t, found)
+	assert.Nil(t, applied.OldValue)
+	applied, found = findApplied(report, "eggs__1__color")
+	require.True(t, found)
+	assert.Equal(t, "blue", applied.OldValue)
+	applied, found = findApplied(report, "db__host")
+	require.True(t, found)
+	assert.Nil(t, applied.OldValue)
+	assert.Equal(t, "localhost", applied.NewValue)
+
+	val, _ := ve.Find("eggs__0__color")
+	assert.Equal(t, "red", val)
+}
+
+func TestDiagnose(t *testing.T) {
+	settings := map[string]interface{}{
+		"empty": map[string]interface{}{},
+		"name":  "bob",
+		"list":  []interface{}{},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim))
+	require.NoError(t, err)
+
+	cases := map[string]error{
+		"empty__*__x": ErrKeyNotFound,
+		"name__*":     ErrScalarInPath,
+		"list__0":     ErrIndexOutOfRange,
+		"name[a=b]":   ErrScalarInPath,
+		"empty[a=b]":  ErrNoSelectorMatch,
+	}
+	for key, reason := range cases {
+		path, ok := ve.splitKey(key)
+		require.True(t, ok, key)
+		err := ve.diagnose(path)
+		assert.True(t, errors.Is(err, reason), "%s: %v", key, err)
+	}
+}
+
+func TestUpdateFromEnv_Strict(t *testing.T) {
+	settings := map[string]interface{}{
+		"nest": map[string]interface{}{
+			"name": "straw",
+			"eggs": []interface{}{
+				map[string]interface{}{"weight": 1},
+			},
+		},
+	}
+	ve, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("STRICTAPP"), WithStrictEnv())
+	require.NoError(t, err)
+	assert.True(t, ve.StrictEnv)
+
+	t.Setenv("STRICTAPP_nest__name", "brick")
+	t.Setenv("STRICTAPP_nest__egs__0__weight", "5")
+	t.Setenv("STRICTAPP_nest__eggs__3__weight", "5")
+	// not prefixed, never considered
+	t.Setenv("OTHERAPP_nest__junk", "5")
+	report, err := ve.UpdateFromEnv()
+	require.Error(t, err)
+
+	var unmatchedErr *UnmatchedEnvError
+	require.True(t, errors.As(err, &unmatchedErr))
+	assert.Len(t, unmatchedErr.Unmatched, 2)
+	assert.Equal(t, "STRICTAPP_", unmatchedErr.Unmatched[0].Prefix)
+	assert.Contains(t, err.Error(), "STRICTAPP_nest__egs__0__weight")
+	assert.Contains(t, err.Error(), "STRICTAPP_nest__eggs__3__weight")
+	assert.Contains(t, err.Error(), "index out of range")
+	assert.NotContains(t, err.Error(), "OTHERAPP")
+	assert.Len(t, report.Applied, 1)
+
+	// nothing was applied
+	val, _ := ve.Find("nest__name")
+	assert.Equal(t, "straw", val)
+
+	// without typos everything applies
+	ve2, err := New(settings, WithDelimiter(keyDelim), WithEnvPrefix("STRICTAPP2"), WithStrictEnv())
+	require.NoError(t, err)
+	t.Setenv("STRICTAPP2_nest__name", "brick")
+	t.Setenv("STRICTAPP2_nest__eggs__0__weight", "5")
+	_, err = ve2.UpdateFromEnv()
+	require.NoError(t, err)
+	val, _ = ve2.Find("nest__name")
+	assert.Equal(t, "brick", val)
+}
+
+func TestUpdateFromEnv_ReplacesSettings(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		options := []func(*ViperEx) error{
+			WithDelimiter(keyDelim),
+			WithEnvPrefix("APP_"),
+			WithEnvSource(EnvMap{"APP_nest__name": "brick"}),
+		}
+		if strict {
+			options = append(options, WithStrictEnv())
+		}
+		ve, err := New(map[string]interface{}{
+			"nest": map[string]interface{}{"name": "straw"},
+		}, options...)
+		require.NoError(t, err)
+
+		before := ve.AllSettings
+		_, err = ve.UpdateFromEnv()
+		require.NoError(t, err)
+		val, _ := ve.Find("nest__name")
+		assert.Equal(t, "brick", val, "strict=%v", strict)
+		// the map obtained earlier is left as it was in both modes
+		assert.Equal(t, "straw", before["nest"].(map[string]interface{})["name"], "strict=%v", strict)
+	}
+}
+
+func TestUpdateFromEnv_StrictWithoutPrefix(t *testing.T) {
+	ve, err := New(map[string]interface{}{"name": "bob"}, WithDelimiter(keyDelim), WithStrictEnv())
+	require.NoError(t, err)
+
+	t.Setenv("nest__junk__value", "5")
+	report, err := ve.UpdateFromEnv()
+	require.NoError(t, err)
+	_, found := findUnmatched(report, "nest__junk__value")
+	assert.True(t, found)
+}